@@ -0,0 +1,241 @@
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// 检查问题级别
+const (
+	CheckError   = "error"
+	CheckWarning = "warning"
+)
+
+// CheckIssue 内容检查发现的问题
+type CheckIssue struct {
+	Level    string
+	FilePath string
+	Message  string
+}
+
+// CheckReport 内容检查报告
+type CheckReport struct {
+	Files  int
+	Issues []CheckIssue
+}
+
+// ErrorCount 错误数量
+func (r *CheckReport) ErrorCount() int {
+	return r.count(CheckError)
+}
+
+// WarningCount 警告数量
+func (r *CheckReport) WarningCount() int {
+	return r.count(CheckWarning)
+}
+
+// HasErrors 是否存在错误（CI 中据此返回非零退出码）
+func (r *CheckReport) HasErrors() bool {
+	return r.ErrorCount() > 0
+}
+
+func (r *CheckReport) count(level string) int {
+	n := 0
+	for _, issue := range r.Issues {
+		if issue.Level == level {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *CheckReport) add(level, path, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, CheckIssue{
+		Level:    level,
+		FilePath: path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+var (
+	linkAttrPattern = regexp.MustCompile(`<(a|img)\s[^>]*?(href|src)="([^"]*)"`)
+	postLinkPattern = regexp.MustCompile(`^/([^/]+)/([^/]+)\.html$`)
+)
+
+// CheckContent 检查 content 目录下所有 Markdown 文件：
+// YAML 语法、标题、日期、跨分类重复 slug、文章间内链（含 Wiki 链接）和上传图片引用
+func CheckContent() *CheckReport {
+	report := &CheckReport{}
+
+	posts := make(map[string]*Post)
+	slugFiles := make(map[string][]string)
+	idFiles := make(map[string][]string)
+	var checked []*Post
+
+	for _, dir := range []string{filepath.Join("content", "blog"), filepath.Join("content", "page")} {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || filepath.Ext(path) != ".md" {
+				return nil
+			}
+			report.Files++
+
+			post := checkFrontMatter(report, path)
+			if post == nil {
+				return nil
+			}
+			checked = append(checked, post)
+			if dir == filepath.Join("content", "blog") {
+				posts[strings.ToLower(post.Category+"/"+post.Slug)] = post
+				slugFiles[post.Slug] = append(slugFiles[post.Slug], path)
+				if post.ID != "" {
+					idFiles[post.ID] = append(idFiles[post.ID], path)
+				}
+			}
+			return nil
+		})
+	}
+
+	// 评论和访问统计按 id 关联文章，复制文件导致的重复 id 会让两篇文章共用数据
+	ids := make([]string, 0, len(idFiles))
+	for id := range idFiles {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if files := idFiles[id]; len(files) > 1 {
+			for _, f := range files {
+				report.add(CheckError, f, "id %q 重复: %s", id, strings.Join(files, ", "))
+			}
+		}
+	}
+
+	// 只写 slug 的 Wiki 链接在同名 slug 之间会有歧义
+	slugs := make([]string, 0, len(slugFiles))
+	for slug := range slugFiles {
+		slugs = append(slugs, slug)
+	}
+	sort.Strings(slugs)
+	for _, slug := range slugs {
+		if files := slugFiles[slug]; len(files) > 1 {
+			for _, f := range files {
+				report.add(CheckWarning, f, "slug %q 在多个分类中重复: %s", slug, strings.Join(files, ", "))
+			}
+		}
+	}
+
+	pageSlugs := make(map[string]bool)
+	pages, _ := ListPages()
+	for _, p := range pages {
+		pageSlugs[p.Slug] = true
+	}
+
+	for _, post := range checked {
+		if len(post.WikiLinks) > 0 {
+			var unresolved []string
+			post.Content, unresolved = resolveWikiLinks(post.Content, posts)
+			for _, target := range unresolved {
+				report.add(CheckError, post.FilePath, "Wiki 链接目标不存在: [[%s]]", target)
+			}
+		}
+		checkLinks(report, post, posts, pageSlugs)
+	}
+
+	return report
+}
+
+// checkFrontMatter 检查单个文件的 front matter，返回解析后的文章（失败时为 nil）
+func checkFrontMatter(report *CheckReport, path string) *Post {
+	post, metaData, metaErr, err := parseMarkdownFile(path)
+	if err != nil {
+		report.add(CheckError, path, "文章解析失败: %v", err)
+		return nil
+	}
+	if metaErr != nil {
+		report.add(CheckError, path, "front matter YAML 无法解析: %v", metaErr)
+	} else {
+		checkMetaFields(report, path, metaData)
+	}
+	return post
+}
+
+// checkMetaFields 检查标题和日期字段
+func checkMetaFields(report *CheckReport, path string, metaData map[string]interface{}) {
+	if title, ok := metaData["title"].(string); !ok || strings.TrimSpace(title) == "" {
+		report.add(CheckError, path, "标题为空")
+	}
+
+	if raw, ok := metaData["date"]; !ok {
+		report.add(CheckWarning, path, "缺少 date")
+	} else if _, err := ParseDate(raw); err != nil {
+		report.add(CheckError, path, "date 无效: %v", err)
+	}
+	for _, key := range []string{"updated", "lastmod"} {
+		if raw, ok := metaData[key]; ok {
+			if _, err := ParseDate(raw); err != nil {
+				report.add(CheckError, path, "%s 无效: %v", key, err)
+			}
+		}
+	}
+}
+
+// checkLinks 检查站内文章链接和上传图片引用
+func checkLinks(report *CheckReport, post *Post, posts map[string]*Post, pageSlugs map[string]bool) {
+	baseURL := strings.TrimSuffix(AppConfig.Site.BaseURL, "/")
+
+	for _, m := range linkAttrPattern.FindAllStringSubmatch(post.Content, -1) {
+		attr, target := m[2], m[3]
+		if baseURL != "" && strings.HasPrefix(target, baseURL+"/") {
+			target = strings.TrimPrefix(target, baseURL)
+		}
+		if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") {
+			continue
+		}
+		if i := strings.IndexAny(target, "?#"); i >= 0 {
+			target = target[:i]
+		}
+		if decoded, err := url.PathUnescape(target); err == nil {
+			target = decoded
+		}
+
+		if attr == "src" {
+			if file := uploadFilePath(target); file != "" {
+				if _, err := os.Stat(file); err != nil {
+					report.add(CheckError, post.FilePath, "图片不存在: %s", m[3])
+				}
+			}
+			continue
+		}
+
+		if strings.HasPrefix(target, "/page/") {
+			slug := strings.TrimSuffix(strings.TrimPrefix(target, "/page/"), ".html")
+			if !pageSlugs[slug] {
+				report.add(CheckError, post.FilePath, "链接的页面不存在: %s", m[3])
+			}
+			continue
+		}
+
+		sm := postLinkPattern.FindStringSubmatch(target)
+		if sm == nil || sm[1] == "category" || sm[1] == "tag" || sm[1] == "static" || sm[1] == "uploads" {
+			continue
+		}
+		if _, ok := posts[strings.ToLower(sm[1]+"/"+sm[2])]; !ok {
+			report.add(CheckError, post.FilePath, "链接的文章不存在: %s", m[3])
+		}
+	}
+}
+
+// uploadFilePath 将上传图片的 URL 映射到磁盘路径，非上传目录返回空
+func uploadFilePath(target string) string {
+	switch {
+	case strings.HasPrefix(target, "/static/uploads/"):
+		return filepath.Join("themes", AppConfig.Theme, "static", filepath.FromSlash(strings.TrimPrefix(target, "/static/")))
+	case strings.HasPrefix(target, "/uploads/"):
+		return filepath.Join("uploads", filepath.FromSlash(strings.TrimPrefix(target, "/uploads/")))
+	}
+	return ""
+}
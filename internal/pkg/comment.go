@@ -4,28 +4,38 @@ import (
 	"encoding/json"
 	"os"
 	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // Comment 评论结构
 type Comment struct {
-	ID        string    `json:"id"`
-	PostSlug  string    `json:"post_slug"`
-	Author    string    `json:"author"`
-	Email     string    `json:"email"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	Approved  bool      `json:"approved"`
-	ParentID  string    `json:"parent_id,omitempty"` // 父评论ID
-	ReplyTo   string    `json:"reply_to,omitempty"`  // 回复的人名
-	Replies   []Comment `json:"-"`                   // 子评论，运行时构建
+	ID            string     `json:"id"`
+	PostID        string     `json:"post_id,omitempty"` // 文章 ID
+	PostSlug      string     `json:"post_slug"`         // 评论时文章的 slug，仅用于展示
+	Author        string     `json:"author"`
+	Email         string     `json:"email"`
+	Content       string     `json:"content"`
+	ContentHTML   string     `json:"content_html,omitempty"` // 渲染后的 HTML，随评论缓存
+	CreatedAt     time.Time  `json:"created_at"`
+	Approved      bool       `json:"approved"`
+	ParentID      string     `json:"parent_id,omitempty"`       // 父评论ID
+	ReplyTo       string     `json:"reply_to,omitempty"`        // 回复的人名
+	IP            string     `json:"ip,omitempty"`              // 提交者 IP
+	Spam          bool       `json:"spam,omitempty"`            // 被规则或管理员标记为垃圾评论
+	Source        string     `json:"source,omitempty"`          // 导入来源，如 disqus:123，重复导入时据此去重
+	EditedAt      *time.Time `json:"edited_at,omitempty"`       // 最后一次修改时间，未修改过为空
+	EditTokenHash string     `json:"edit_token_hash,omitempty"` // 评论者编辑令牌的 SHA-256，令牌原文只保存在评论者的 Cookie 中
+	Replies       []Comment  `json:"-"`                         // 子评论，运行时构建
+	Depth         int        `json:"-"`                         // 在评论树中的层级，顶级为 0
 }
 
 var (
-	comments     []Comment
-	commentsLock sync.RWMutex
-	commentsFile = "data/comments.json"
+	comments      []Comment
+	commentsLock  sync.RWMutex
+	commentsFile  = "data/comments.json"
+	commentCounts = make(map[string]int) // 文章 ID -> 已发布评论数，评论变动时重新统计
 )
 
 // InitComments 初始化评论系统
@@ -45,10 +55,38 @@ func LoadComments() {
 		return
 	}
 	json.Unmarshal(data, &comments)
+
+	// 旧数据没有缓存的 HTML，载入时补上
+	for i := range comments {
+		if comments[i].ContentHTML == "" {
+			comments[i].ContentHTML = RenderCommentMarkdown(comments[i].Content)
+		}
+	}
+	countComments()
+}
+
+// countComments 重新统计各文章的已发布评论数，调用方需持有 commentsLock 写锁
+func countComments() {
+	counts := make(map[string]int)
+	for _, c := range comments {
+		if c.Approved && !c.Spam {
+			counts[c.PostID]++
+		}
+	}
+	commentCounts = counts
+}
+
+// CommentCount 文章的已发布评论数，供列表页模板使用
+func (p *Post) CommentCount() int {
+	commentsLock.RLock()
+	defer commentsLock.RUnlock()
+	return commentCounts[p.ID]
 }
 
-// SaveComments 保存评论到文件
+// SaveComments 保存评论到文件，评论有变动都会经过这里，顺带刷新评论数
 func saveComments() error {
+	countComments()
+	InvalidatePageCache()
 	data, err := json.MarshalIndent(comments, "", "  ")
 	if err != nil {
 		return err
@@ -56,75 +94,95 @@ func saveComments() error {
 	return os.WriteFile(commentsFile, data, 0644)
 }
 
-// AddComment 添加评论
-func AddComment(postSlug, author, email, content, parentID, replyTo string) (*Comment, error) {
+// AddComment 添加评论，按审核模式和反垃圾规则决定是否直接发布。
+// 同时返回编辑令牌，评论者凭它在时限内修改或删除自己的评论
+func AddComment(post *Post, author, email, content, parentID, replyTo, ip string) (*Comment, string, error) {
 	commentsLock.Lock()
 	defer commentsLock.Unlock()
 
+	// 父评论不存在或属于其他文章时作为顶级评论
+	if parentID != "" && !parentInPost(parentID, post.ID) {
+		parentID, replyTo = "", ""
+	}
+
+	token := newCommentEditToken()
+	spam := isSpamComment(author, email, content)
 	comment := Comment{
-		ID:        time.Now().Format("20060102150405"),
-		PostSlug:  postSlug,
-		Author:    author,
-		Email:     email,
-		Content:   content,
-		CreatedAt: time.Now(),
-		Approved:  true,
-		ParentID:  parentID,
-		ReplyTo:   replyTo,
+		ID:            NewULID(),
+		PostID:        post.ID,
+		PostSlug:      post.Slug,
+		Author:        author,
+		Email:         email,
+		Content:       content,
+		ContentHTML:   RenderCommentMarkdown(content),
+		CreatedAt:     time.Now(),
+		Approved:      !spam && !needsModeration(author, email, ip),
+		ParentID:      parentID,
+		ReplyTo:       replyTo,
+		IP:            ip,
+		Spam:          spam,
+		EditTokenHash: hashCommentEditToken(token),
 	}
 
 	comments = append(comments, comment)
-	err := saveComments()
-	return &comment, err
-}
+	if err := saveComments(); err != nil {
+		return &comment, "", err
+	}
+	commentSubmissions.Inc(commentState(comment))
 
-// GetCommentsByPost 获取文章的评论（树形结构）
-func GetCommentsByPost(postSlug string) []Comment {
-	commentsLock.RLock()
-	defer commentsLock.RUnlock()
+	notifyAdmin(comment)
+	notifyReply(comment, findComment(parentID))
+	return &comment, token, nil
+}
 
-	// 获取该文章的所有已审核评论
-	var all []*Comment
-	for i := range comments {
-		if comments[i].PostSlug == postSlug && comments[i].Approved {
-			c := comments[i] // 复制一份
-			c.Replies = []Comment{}
-			all = append(all, &c)
+// needsModeration 按审核模式判断新评论是否需要审核，调用方需持有 commentsLock
+func needsModeration(author, email, ip string) bool {
+	switch AppConfig.Comments.Moderation {
+	case ModerationAll:
+		return true
+	case ModerationFirstTime:
+		// 有邮箱按邮箱识别，否则按昵称 + IP 识别
+		email = strings.ToLower(strings.TrimSpace(email))
+		for _, c := range comments {
+			if !c.Approved || c.Spam {
+				continue
+			}
+			if email != "" && strings.ToLower(c.Email) == email {
+				return false
+			}
+			if email == "" && c.Email == "" && c.Author == author && c.IP == ip {
+				return false
+			}
 		}
+		return true
 	}
+	return false
+}
 
-	// 先按时间排序
-	sort.Slice(all, func(i, j int) bool {
-		return all[i].CreatedAt.Before(all[j].CreatedAt)
-	})
-
-	// 建立索引
-	commentMap := make(map[string]*Comment)
-	for _, c := range all {
-		commentMap[c.ID] = c
-	}
+// GetCommentsByPost 获取文章的全部评论（树形结构，按默认方式排序）
+func GetCommentsByPost(postID string) []Comment {
+	threads, _ := buildCommentTree(postID, normalizeCommentSort(""))
+	return threads
+}
 
-	// 构建树
-	var roots []Comment
-	for _, c := range all {
-		if c.ParentID == "" {
-			roots = append(roots, *c)
-		} else if parent, ok := commentMap[c.ParentID]; ok {
-			parent.Replies = append(parent.Replies, *c)
-		} else {
-			// 父评论不存在，作为顶级评论
-			roots = append(roots, *c)
-		}
-	}
+// GetRecentComments 按时间倒序获取已发布的评论，postID 为空时不限文章
+func GetRecentComments(postID string, limit int) []Comment {
+	commentsLock.RLock()
+	defer commentsLock.RUnlock()
 
-	// 重新构建 roots，确保包含最新的 Replies
 	var result []Comment
-	for _, c := range all {
-		if c.ParentID == "" {
-			result = append(result, *c)
+	for _, c := range comments {
+		if c.Approved && !c.Spam && (postID == "" || c.PostID == postID) {
+			result = append(result, c)
 		}
 	}
 
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
 	return result
 }
 
@@ -135,7 +193,7 @@ func GetAllComments() []Comment {
 
 	result := make([]Comment, len(comments))
 	copy(result, comments)
-	
+
 	// 按时间倒序
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].CreatedAt.After(result[j].CreatedAt)
@@ -150,11 +208,11 @@ func GetPendingComments() []Comment {
 
 	var result []Comment
 	for _, c := range comments {
-		if !c.Approved {
+		if !c.Approved && !c.Spam {
 			result = append(result, c)
 		}
 	}
-	
+
 	sort.Slice(result, func(i, j int) bool {
 		return result[i].CreatedAt.After(result[j].CreatedAt)
 	})
@@ -168,7 +226,33 @@ func ApproveComment(id string) error {
 
 	for i := range comments {
 		if comments[i].ID == id {
+			wasApproved := comments[i].Approved
 			comments[i].Approved = true
+			comments[i].Spam = false
+			if err := saveComments(); err != nil {
+				return err
+			}
+			// 审核通过后才通知被回复者
+			if !wasApproved {
+				notifyReply(comments[i], findComment(comments[i].ParentID))
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// MarkCommentSpam 标记或取消标记垃圾评论，垃圾评论不会展示也不进入待审核列表
+func MarkCommentSpam(id string, spam bool) error {
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	for i := range comments {
+		if comments[i].ID == id {
+			comments[i].Spam = spam
+			if spam {
+				comments[i].Approved = false
+			}
 			return saveComments()
 		}
 	}
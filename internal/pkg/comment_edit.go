@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// 评论者修改、删除自己评论时的错误
+var (
+	ErrCommentNotFound    = errors.New("评论不存在")
+	ErrCommentEditDenied  = errors.New("无权修改这条评论")
+	ErrCommentEditExpired = errors.New("已超过可修改时间")
+)
+
+// newCommentEditToken 生成评论编辑令牌，原文交给评论者，服务端只保存哈希
+func newCommentEditToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func hashCommentEditToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CommentEditWindow 评论者可修改、删除自己评论的时限，0 表示关闭
+func CommentEditWindow() time.Duration {
+	m := AppConfig.Comments.EditWindow
+	if m < 0 {
+		return 0
+	}
+	if m == 0 {
+		m = 15
+	}
+	return time.Duration(m) * time.Minute
+}
+
+// checkEditToken 校验令牌和时限
+func checkEditToken(c *Comment, token string) error {
+	if c.EditTokenHash == "" || token == "" {
+		return ErrCommentEditDenied
+	}
+	if subtle.ConstantTimeCompare([]byte(c.EditTokenHash), []byte(hashCommentEditToken(token))) != 1 {
+		return ErrCommentEditDenied
+	}
+	window := CommentEditWindow()
+	if window == 0 || time.Since(c.CreatedAt) > window {
+		return ErrCommentEditExpired
+	}
+	return nil
+}
+
+// commentIndex 按 ID 查找评论下标，调用方需持有 commentsLock
+func commentIndex(id string) int {
+	for i := range comments {
+		if comments[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// EditableComments 从评论者持有的令牌（评论 ID -> 令牌）中筛出仍可修改的评论 ID
+func EditableComments(tokens map[string]string) map[string]bool {
+	commentsLock.RLock()
+	defer commentsLock.RUnlock()
+
+	result := make(map[string]bool)
+	for id, token := range tokens {
+		if i := commentIndex(id); i >= 0 && checkEditToken(&comments[i], token) == nil {
+			result[id] = true
+		}
+	}
+	return result
+}
+
+// EditOwnComment 评论者凭令牌修改自己的评论，修改后的内容重新经过反垃圾规则
+func EditOwnComment(id, token, content string) (*Comment, error) {
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	i := commentIndex(id)
+	if i < 0 {
+		return nil, ErrCommentNotFound
+	}
+	if err := checkEditToken(&comments[i], token); err != nil {
+		return nil, err
+	}
+
+	setCommentContent(&comments[i], content)
+	if isSpamComment(comments[i].Author, comments[i].Email, content) {
+		comments[i].Spam = true
+		comments[i].Approved = false
+	}
+	c := comments[i]
+	return &c, saveComments()
+}
+
+// DeleteOwnComment 评论者凭令牌删除自己的评论
+func DeleteOwnComment(id, token string) error {
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	i := commentIndex(id)
+	if i < 0 {
+		return ErrCommentNotFound
+	}
+	if err := checkEditToken(&comments[i], token); err != nil {
+		return err
+	}
+	comments = append(comments[:i], comments[i+1:]...)
+	return saveComments()
+}
+
+// UpdateComment 管理员修改任意评论的内容
+func UpdateComment(id, content string) error {
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	i := commentIndex(id)
+	if i < 0 {
+		return ErrCommentNotFound
+	}
+	setCommentContent(&comments[i], content)
+	return saveComments()
+}
+
+func setCommentContent(c *Comment, content string) {
+	now := time.Now()
+	c.Content = content
+	c.ContentHTML = RenderCommentMarkdown(content)
+	c.EditedAt = &now
+}
+
+// EditedTime 最后修改时间，未修改过返回零值，供模板格式化
+func (c Comment) EditedTime() time.Time {
+	if c.EditedAt == nil {
+		return time.Time{}
+	}
+	return *c.EditedAt
+}
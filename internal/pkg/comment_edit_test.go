@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCheckEditToken(t *testing.T) {
+	setupTestDir(t)
+	token := newCommentEditToken()
+	hash := hashCommentEditToken(token)
+
+	tests := []struct {
+		name   string
+		window int // edit_window 配置（分钟）
+		age    time.Duration
+		hash   string
+		token  string
+		want   error
+	}{
+		{"fresh", 0, time.Minute, hash, token, nil},
+		{"default window is 15 minutes", 0, 16 * time.Minute, hash, token, ErrCommentEditExpired},
+		{"configured window", 60, 30 * time.Minute, hash, token, nil},
+		{"past configured window", 60, 61 * time.Minute, hash, token, ErrCommentEditExpired},
+		{"disabled", -1, time.Second, hash, token, ErrCommentEditExpired},
+		{"wrong token", 0, time.Minute, hash, newCommentEditToken(), ErrCommentEditDenied},
+		{"empty token", 0, time.Minute, hash, "", ErrCommentEditDenied},
+		{"comment without token", 0, time.Minute, "", token, ErrCommentEditDenied},
+		{"wrong token after expiry", 0, time.Hour, hash, "x", ErrCommentEditDenied},
+	}
+	for _, tt := range tests {
+		AppConfig.Comments.EditWindow = tt.window
+		c := &Comment{EditTokenHash: tt.hash, CreatedAt: time.Now().Add(-tt.age)}
+		if err := checkEditToken(c, tt.token); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestEditOwnComment(t *testing.T) {
+	setupTestDir(t)
+	InitMarkdown()
+	token := newCommentEditToken()
+	hash := hashCommentEditToken(token)
+	setTestComments(t, []Comment{
+		{ID: "fresh", PostID: "01POST", Content: "old", Approved: true, EditTokenHash: hash, CreatedAt: time.Now().Add(-time.Minute)},
+		{ID: "expired", PostID: "01POST", Content: "old", Approved: true, EditTokenHash: hash, CreatedAt: time.Now().Add(-time.Hour)},
+	})
+
+	editable := EditableComments(map[string]string{"fresh": token, "expired": token, "missing": token})
+	if len(editable) != 1 || !editable["fresh"] {
+		t.Errorf("EditableComments = %v, want only fresh", editable)
+	}
+
+	c, err := EditOwnComment("fresh", token, "new **text**")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Content != "new **text**" || c.ContentHTML != "<p>new <strong>text</strong></p>\n" || c.EditedAt == nil {
+		t.Errorf("edited comment = %+v", c)
+	}
+	if _, err := EditOwnComment("expired", token, "new"); err != ErrCommentEditExpired {
+		t.Errorf("expired edit: got %v", err)
+	}
+	if _, err := EditOwnComment("missing", token, "new"); err != ErrCommentNotFound {
+		t.Errorf("missing edit: got %v", err)
+	}
+
+	if err := DeleteOwnComment("expired", token); err != ErrCommentEditExpired {
+		t.Errorf("expired delete: got %v", err)
+	}
+	if err := DeleteOwnComment("fresh", "wrong"); err != ErrCommentEditDenied {
+		t.Errorf("delete with wrong token: got %v", err)
+	}
+	if err := DeleteOwnComment("fresh", token); err != nil {
+		t.Fatal(err)
+	}
+	if list := GetAllComments(); len(list) != 1 || list[0].ID != "expired" {
+		t.Errorf("after delete: %+v", list)
+	}
+}
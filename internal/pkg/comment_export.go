@@ -0,0 +1,267 @@
+package pkg
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportedComment JSON 导出格式：评论本身加上文章链接和标题，方便导入到其他站点时匹配文章
+type exportedComment struct {
+	Comment
+	PostURL   string `json:"post_url,omitempty"`
+	PostTitle string `json:"post_title,omitempty"`
+}
+
+// ExportComments 按指定格式导出全部评论。
+// WXR 和 Disqus 按文章分组，找不到文章的评论不导出；Disqus 没有待审核状态，待审核评论也不导出
+func ExportComments(format string) ([]byte, error) {
+	commentsLock.RLock()
+	list := make([]Comment, len(comments))
+	copy(list, comments)
+	commentsLock.RUnlock()
+
+	sort.SliceStable(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	switch format {
+	case CommentFormatJSON:
+		return exportJSONComments(list)
+	case CommentFormatWXR:
+		return exportWXRComments(list)
+	case CommentFormatDisqus:
+		return exportDisqusComments(list)
+	}
+	return nil, fmt.Errorf("不支持的导出格式 %q，支持 json、wxr、disqus", format)
+}
+
+func absoluteURL(path string) string {
+	return strings.TrimSuffix(AppConfig.Site.BaseURL, "/") + path
+}
+
+func exportJSONComments(list []Comment) ([]byte, error) {
+	result := make([]exportedComment, 0, len(list))
+	for _, c := range list {
+		c.EditTokenHash = ""
+		e := exportedComment{Comment: c}
+		if post := GetPostByID(c.PostID); post != nil {
+			e.PostURL = absoluteURL(post.Permalink())
+			e.PostTitle = post.Title
+		}
+		result = append(result, e)
+	}
+	return json.MarshalIndent(result, "", "  ")
+}
+
+// groupByPost 按文章分组，保持文章首次出现的顺序
+func groupByPost(list []Comment) ([]*Post, map[string][]Comment) {
+	var posts []*Post
+	groups := make(map[string][]Comment)
+	for _, c := range list {
+		post := GetPostByID(c.PostID)
+		if post == nil {
+			continue
+		}
+		if _, ok := groups[post.ID]; !ok {
+			posts = append(posts, post)
+		}
+		groups[post.ID] = append(groups[post.ID], c)
+	}
+	return posts, groups
+}
+
+// ========== WXR ==========
+
+const wxrTimeLayout = "2006-01-02 15:04:05"
+
+type wxrExport struct {
+	XMLName   xml.Name `xml:"rss"`
+	Version   string   `xml:"version,attr"`
+	NSContent string   `xml:"xmlns:content,attr"`
+	NSDC      string   `xml:"xmlns:dc,attr"`
+	NSWP      string   `xml:"xmlns:wp,attr"`
+	Channel   struct {
+		Title      string          `xml:"title"`
+		Link       string          `xml:"link"`
+		WXRVersion string          `xml:"wp:wxr_version"`
+		Items      []wxrExportItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type wxrExportItem struct {
+	Title    string             `xml:"title"`
+	Link     string             `xml:"link"`
+	PostID   int                `xml:"wp:post_id"`
+	PostDate string             `xml:"wp:post_date"`
+	PostName string             `xml:"wp:post_name"`
+	Status   string             `xml:"wp:status"`
+	PostType string             `xml:"wp:post_type"`
+	Comments []wxrExportComment `xml:"wp:comment"`
+}
+
+type wxrExportComment struct {
+	ID          int    `xml:"wp:comment_id"`
+	Author      string `xml:"wp:comment_author"`
+	AuthorEmail string `xml:"wp:comment_author_email"`
+	AuthorIP    string `xml:"wp:comment_author_IP"`
+	Date        string `xml:"wp:comment_date"`
+	DateGMT     string `xml:"wp:comment_date_gmt"`
+	Content     string `xml:"wp:comment_content"`
+	Approved    string `xml:"wp:comment_approved"`
+	Type        string `xml:"wp:comment_type"`
+	Parent      int    `xml:"wp:comment_parent"`
+}
+
+func exportWXRComments(list []Comment) ([]byte, error) {
+	var doc wxrExport
+	doc.Version = "2.0"
+	doc.NSContent = "http://purl.org/rss/1.0/modules/content/"
+	doc.NSDC = "http://purl.org/dc/elements/1.1/"
+	doc.NSWP = "http://wordpress.org/export/1.2/"
+	doc.Channel.Title = AppConfig.Site.Title
+	doc.Channel.Link = AppConfig.Site.BaseURL
+	doc.Channel.WXRVersion = "1.2"
+
+	// WXR 的评论 ID 是整数，按导出顺序编号
+	numOf := make(map[string]int)
+	for i, c := range list {
+		numOf[c.ID] = i + 1
+	}
+
+	posts, groups := groupByPost(list)
+	for i, post := range posts {
+		item := wxrExportItem{
+			Title:    post.Title,
+			Link:     absoluteURL(post.Permalink()),
+			PostID:   i + 1,
+			PostDate: post.Date.Format(wxrTimeLayout),
+			PostName: post.Slug,
+			Status:   "publish",
+			PostType: "post",
+		}
+		for _, c := range groups[post.ID] {
+			approved := "0"
+			if c.Spam {
+				approved = "spam"
+			} else if c.Approved {
+				approved = "1"
+			}
+			item.Comments = append(item.Comments, wxrExportComment{
+				ID:          numOf[c.ID],
+				Author:      c.Author,
+				AuthorEmail: c.Email,
+				AuthorIP:    c.IP,
+				Date:        c.CreatedAt.Local().Format(wxrTimeLayout),
+				DateGMT:     c.CreatedAt.UTC().Format(wxrTimeLayout),
+				Content:     c.Content,
+				Approved:    approved,
+				Type:        "comment",
+				Parent:      numOf[c.ParentID],
+			})
+		}
+		doc.Channel.Items = append(doc.Channel.Items, item)
+	}
+	return marshalXML(doc)
+}
+
+// ========== Disqus ==========
+
+type disqusExport struct {
+	XMLName xml.Name             `xml:"disqus"`
+	NS      string               `xml:"xmlns,attr"`
+	NSDsq   string               `xml:"xmlns:dsq,attr"`
+	Threads []disqusExportThread `xml:"thread"`
+	Posts   []disqusExportPost   `xml:"post"`
+}
+
+type disqusExportThread struct {
+	DsqID      string `xml:"dsq:id,attr"`
+	Identifier string `xml:"id"`
+	Link       string `xml:"link"`
+	Title      string `xml:"title"`
+	CreatedAt  string `xml:"createdAt"`
+}
+
+type disqusRef struct {
+	DsqID string `xml:"dsq:id,attr"`
+}
+
+type disqusExportPost struct {
+	DsqID     string      `xml:"dsq:id,attr"`
+	ID        string      `xml:"id"`
+	Message   disqusCDATA `xml:"message"`
+	CreatedAt string      `xml:"createdAt"`
+	IsDeleted bool        `xml:"isDeleted"`
+	IsSpam    bool        `xml:"isSpam"`
+	Author    struct {
+		Email       string `xml:"email"`
+		Name        string `xml:"name"`
+		IsAnonymous bool   `xml:"isAnonymous"`
+	} `xml:"author"`
+	IPAddress string     `xml:"ipAddress"`
+	Thread    disqusRef  `xml:"thread"`
+	Parent    *disqusRef `xml:"parent,omitempty"`
+}
+
+type disqusCDATA struct {
+	Text string `xml:",cdata"`
+}
+
+func exportDisqusComments(list []Comment) ([]byte, error) {
+	doc := disqusExport{
+		NS:    "http://disqus.com",
+		NSDsq: "http://disqus.com/disqus-internals",
+	}
+
+	numOf := make(map[string]string)
+	for i, c := range list {
+		numOf[c.ID] = strconv.Itoa(i + 1)
+	}
+
+	posts, groups := groupByPost(list)
+	for i, post := range posts {
+		threadID := strconv.Itoa(len(list) + i + 1) // 与评论编号错开
+		doc.Threads = append(doc.Threads, disqusExportThread{
+			DsqID:      threadID,
+			Identifier: post.ID,
+			Link:       absoluteURL(post.Permalink()),
+			Title:      post.Title,
+			CreatedAt:  post.Date.UTC().Format(time.RFC3339),
+		})
+		for _, c := range groups[post.ID] {
+			if !c.Approved && !c.Spam {
+				continue
+			}
+			p := disqusExportPost{
+				DsqID:     numOf[c.ID],
+				ID:        c.ID,
+				Message:   disqusCDATA{c.ContentHTML},
+				CreatedAt: c.CreatedAt.UTC().Format(time.RFC3339),
+				IsSpam:    c.Spam,
+				IPAddress: c.IP,
+				Thread:    disqusRef{threadID},
+			}
+			p.Author.Email = c.Email
+			p.Author.Name = c.Author
+			p.Author.IsAnonymous = c.Email == ""
+			if parent := numOf[c.ParentID]; c.ParentID != "" && parent != "" {
+				p.Parent = &disqusRef{parent}
+			}
+			doc.Posts = append(doc.Posts, p)
+		}
+	}
+	return marshalXML(doc)
+}
+
+func marshalXML(v interface{}) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
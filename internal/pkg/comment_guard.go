@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 评论提交被拦截的原因
+var (
+	ErrCommentToken     = errors.New("表单已失效，请刷新页面后重试")
+	ErrCommentTooFast   = errors.New("提交太快了，请稍后再试")
+	ErrCommentRateLimit = errors.New("评论过于频繁，请稍后再试")
+	ErrCommentBanned    = errors.New("你已被禁止评论")
+)
+
+var (
+	commentLimiter = newRateLimiter()
+
+	formSecretOnce sync.Once
+	formSecret     []byte
+)
+
+// commentFormSecret 表单令牌签名密钥，未配置 JWT 密钥时使用进程内随机值
+func commentFormSecret() []byte {
+	formSecretOnce.Do(func() {
+		if AppConfig.JWTSecret != "" {
+			formSecret = []byte("comment-form:" + AppConfig.JWTSecret)
+			return
+		}
+		formSecret = make([]byte, 32)
+		rand.Read(formSecret)
+	})
+	return formSecret
+}
+
+func signFormTime(ts string) string {
+	mac := hmac.New(sha256.New, commentFormSecret())
+	mac.Write([]byte(ts))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// NewCommentFormToken 生成评论表单令牌（签名的页面渲染时间），用于校验最短提交时间
+func NewCommentFormToken() string {
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	return ts + "." + signFormTime(ts)
+}
+
+// CheckCommentFormToken 校验表单令牌，令牌有效期为 24 小时
+func CheckCommentFormToken(token string) error {
+	ts, sig, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signFormTime(ts))) {
+		return ErrCommentToken
+	}
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return ErrCommentToken
+	}
+	elapsed := time.Since(time.Unix(unix, 0))
+	if elapsed > 24*time.Hour {
+		return ErrCommentToken
+	}
+	minTime := AppConfig.Comments.MinSubmitTime
+	if minTime == 0 {
+		minTime = 3
+	}
+	if minTime > 0 && elapsed < time.Duration(minTime)*time.Second {
+		return ErrCommentTooFast
+	}
+	return nil
+}
+
+// rateLimiter 按 IP 记录窗口内的请求时间
+type rateLimiter struct {
+	lock sync.Mutex
+	hits map[string][]time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{hits: make(map[string][]time.Time)}
+}
+
+// allow 窗口内请求数未达到 limit 时记录本次请求并返回 true
+func (l *rateLimiter) allow(ip string, limit int, window time.Duration) bool {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := time.Now()
+	recent := l.hits[ip][:0]
+	for _, t := range l.hits[ip] {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= limit {
+		l.hits[ip] = recent
+		return false
+	}
+	l.hits[ip] = append(recent, now)
+
+	// 顺带清理过期的 IP，避免无限增长
+	if len(l.hits) > 1000 {
+		for k, times := range l.hits {
+			if len(times) == 0 || now.Sub(times[len(times)-1]) >= window {
+				delete(l.hits, k)
+			}
+		}
+	}
+	return true
+}
+
+// AllowCommentFrom 按 IP 限流，允许时记录本次提交
+func AllowCommentFrom(ip string) bool {
+	limit := AppConfig.Comments.RateLimit
+	if limit == 0 {
+		limit = 5
+	}
+	if limit < 0 {
+		return true
+	}
+	window := time.Duration(AppConfig.Comments.RateWindow) * time.Second
+	if window <= 0 {
+		window = 10 * time.Minute
+	}
+
+	return commentLimiter.allow(ip, limit, window)
+}
+
+// IsCommentBanned IP 或邮箱是否在黑名单中
+func IsCommentBanned(ip, email string) bool {
+	commentBansLock.RLock()
+	defer commentBansLock.RUnlock()
+
+	for _, banned := range AppConfig.Comments.BannedIPs {
+		if ip != "" && banned == ip {
+			return true
+		}
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, banned := range AppConfig.Comments.BannedEmails {
+		if email != "" && strings.ToLower(banned) == email {
+			return true
+		}
+	}
+	return false
+}
+
+// isSpamComment 关键词或链接数量命中规则时视为垃圾评论
+func isSpamComment(author, email, content string) bool {
+	text := strings.ToLower(author + "\n" + email + "\n" + content)
+	for _, keyword := range AppConfig.Comments.BlockedKeywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" && strings.Contains(text, keyword) {
+			return true
+		}
+	}
+
+	maxLinks := AppConfig.Comments.MaxLinks
+	if maxLinks > 0 {
+		lower := strings.ToLower(content)
+		links := strings.Count(lower, "http://") + strings.Count(lower, "https://")
+		if links > maxLinks {
+			return true
+		}
+	}
+	return false
+}
+
+// BanCommenter 将评论者的 IP 或邮箱加入黑名单，kind 为 ip 或 email
+func BanCommenter(id, kind string) error {
+	commentsLock.RLock()
+	var target *Comment
+	for i := range comments {
+		if comments[i].ID == id {
+			c := comments[i]
+			target = &c
+			break
+		}
+	}
+	commentsLock.RUnlock()
+	if target == nil {
+		return fmt.Errorf("评论不存在")
+	}
+
+	// 读取、追加、写回期间持有写锁，避免并发封禁互相覆盖
+	commentBansLock.Lock()
+	defer commentBansLock.Unlock()
+
+	ips := append([]string(nil), AppConfig.Comments.BannedIPs...)
+	emails := append([]string(nil), AppConfig.Comments.BannedEmails...)
+	switch kind {
+	case "ip":
+		if target.IP == "" {
+			return fmt.Errorf("该评论没有记录 IP")
+		}
+		ips = appendUnique(ips, target.IP)
+	case "email":
+		if target.Email == "" {
+			return fmt.Errorf("该评论没有填写邮箱")
+		}
+		emails = appendUnique(emails, strings.ToLower(target.Email))
+	default:
+		return fmt.Errorf("未知的封禁类型: %s", kind)
+	}
+	return updateCommentBans(ips, emails)
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, v := range list {
+		if v == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
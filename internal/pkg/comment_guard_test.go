@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestCheckCommentFormTokenMinSubmitTime(t *testing.T) {
+	setupTestDir(t)
+
+	// 伪造一个 2 秒前签发的令牌
+	ts := strconv.FormatInt(time.Now().Add(-2*time.Second).Unix(), 10)
+	token := ts + "." + signFormTime(ts)
+
+	tests := []struct {
+		minTime int
+		want    error
+	}{
+		{0, ErrCommentTooFast}, // 0 使用默认值 3 秒
+		{1, nil},
+		{5, ErrCommentTooFast},
+		{-1, nil}, // 关闭
+	}
+	for _, tt := range tests {
+		AppConfig.Comments.MinSubmitTime = tt.minTime
+		if err := CheckCommentFormToken(token); err != tt.want {
+			t.Errorf("min_submit_time %d: got %v, want %v", tt.minTime, err, tt.want)
+		}
+	}
+
+	if err := CheckCommentFormToken(ts + ".bad"); err != ErrCommentToken {
+		t.Errorf("forged token: got %v, want %v", err, ErrCommentToken)
+	}
+}
+
+func TestRateLimitersAreIndependent(t *testing.T) {
+	commentLimiter, webmentionLimiter = newRateLimiter(), newRateLimiter()
+	t.Cleanup(func() { commentLimiter, webmentionLimiter = newRateLimiter(), newRateLimiter() })
+
+	ip := "192.0.2.10"
+	for i := 0; i < webmentionRateLimit; i++ {
+		if !AllowWebmentionFrom(ip) {
+			t.Fatalf("webmention %d rejected before reaching the limit", i+1)
+		}
+	}
+	if AllowWebmentionFrom(ip) {
+		t.Error("webmention allowed past the limit")
+	}
+	if !AllowCommentFrom(ip) {
+		t.Error("webmentions used up the comment quota")
+	}
+}
+
+func TestBanCommenterConcurrent(t *testing.T) {
+	setupTestDir(t)
+	os.WriteFile("config.yaml", nil, 0644)
+	viper.SetConfigFile("config.yaml")
+
+	var list []Comment
+	for i := 0; i < 20; i++ {
+		list = append(list, Comment{ID: fmt.Sprint(i), IP: fmt.Sprintf("192.0.2.%d", i)})
+	}
+	setTestComments(t, list)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if err := BanCommenter(fmt.Sprint(i), "ip"); err != nil {
+				t.Error(err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			IsCommentBanned(fmt.Sprintf("192.0.2.%d", i), "")
+		}()
+	}
+	wg.Wait()
+
+	// 并发封禁不应互相覆盖
+	for i := 0; i < 20; i++ {
+		if !IsCommentBanned(fmt.Sprintf("192.0.2.%d", i), "") {
+			t.Errorf("192.0.2.%d was not banned", i)
+		}
+	}
+}
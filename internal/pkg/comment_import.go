@@ -0,0 +1,516 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// 评论导入导出支持的格式
+const (
+	CommentFormatJSON   = "json"   // mdblog 自身的 JSON 格式
+	CommentFormatWXR    = "wxr"    // WordPress 导出文件（WXR）
+	CommentFormatDisqus = "disqus" // Disqus 导出的 XML
+)
+
+// CommentImportReport 导入结果，DryRun 时只统计不写入
+type CommentImportReport struct {
+	Format    string            `json:"format"`
+	DryRun    bool              `json:"dry_run"`
+	Threads   int               `json:"threads"`   // 源数据中有评论的文章（讨论串）数
+	Total     int               `json:"total"`     // 源数据中的评论数
+	Imported  int               `json:"imported"`  // 导入（DryRun 时为可导入）的评论数
+	Duplicate int               `json:"duplicate"` // 之前已导入过的评论数
+	Skipped   int               `json:"skipped"`   // 已删除、pingback 等被忽略的评论数
+	Unmatched []UnmatchedThread `json:"unmatched"` // 找不到对应文章的讨论串
+}
+
+// UnmatchedThread 找不到对应文章的讨论串
+type UnmatchedThread struct {
+	Title    string `json:"title"`
+	URL      string `json:"url"`
+	Comments int    `json:"comments"`
+}
+
+// importThread 源数据中的一篇文章（讨论串），用于匹配本站文章
+type importThread struct {
+	Key    string // 源数据中的唯一标识
+	PostID string // 已知的本站文章 ID（JSON 格式）
+	URL    string
+	Title  string
+	Slug   string // 源数据给出的 slug 或标识符
+}
+
+// importedComment 各格式解析后的统一结构
+type importedComment struct {
+	SourceID  string
+	ParentID  string // 源数据中的父评论 ID
+	Thread    string // importThread.Key
+	Author    string
+	Email     string
+	IP        string
+	Content   string // Markdown
+	CreatedAt time.Time
+	Approved  bool
+	Spam      bool
+}
+
+// DetectCommentFormat 根据文件内容判断导入格式，无法识别时返回空字符串
+func DetectCommentFormat(data []byte) string {
+	head := bytes.TrimSpace(data)
+	if len(head) > 4096 {
+		head = head[:4096]
+	}
+	switch {
+	case bytes.HasPrefix(head, []byte("[")) || bytes.HasPrefix(head, []byte("{")):
+		return CommentFormatJSON
+	case bytes.Contains(head, []byte("<disqus")):
+		return CommentFormatDisqus
+	case bytes.Contains(head, []byte("wordpress.org/export")):
+		return CommentFormatWXR
+	}
+	return ""
+}
+
+// ImportComments 导入评论到 data/comments.json。
+// 讨论串按 文章 ID、链接路径、slug、标题 的顺序匹配本站文章，匹配不到的记入报告；
+// 重复导入同一文件不会产生重复评论。导入的评论不发送邮件通知
+func ImportComments(data []byte, format string, dryRun bool) (*CommentImportReport, error) {
+	if format == "" {
+		format = DetectCommentFormat(data)
+	}
+
+	var threads []importThread
+	var items []importedComment
+	var skipped int
+	var err error
+	switch format {
+	case CommentFormatJSON:
+		threads, items, err = parseJSONComments(data)
+	case CommentFormatWXR:
+		threads, items, skipped, err = parseWXRComments(data)
+	case CommentFormatDisqus:
+		threads, items, skipped, err = parseDisqusComments(data)
+	default:
+		return nil, fmt.Errorf("无法识别的评论格式 %q，支持 json、wxr、disqus", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析 %s 失败: %w", format, err)
+	}
+
+	report := &CommentImportReport{
+		Format:  format,
+		DryRun:  dryRun,
+		Total:   len(items) + skipped,
+		Skipped: skipped,
+	}
+	withComments := make(map[string]bool)
+	for _, item := range items {
+		withComments[item.Thread] = true
+	}
+	report.Threads = len(withComments)
+
+	// 讨论串 -> 文章
+	postOf := make(map[string]*Post, len(threads))
+	unmatched := make(map[string]*UnmatchedThread)
+	var unmatchedOrder []string
+	matcher := newThreadMatcher()
+	for _, t := range threads {
+		if !withComments[t.Key] {
+			continue
+		}
+		if post := matcher.match(t); post != nil {
+			postOf[t.Key] = post
+			continue
+		}
+		unmatched[t.Key] = &UnmatchedThread{Title: t.Title, URL: t.URL}
+		unmatchedOrder = append(unmatchedOrder, t.Key)
+	}
+
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	// 已有评论的 ID 和来源，用于去重和关联父评论
+	idOf := make(map[string]string)
+	existingIDs := make(map[string]bool, len(comments))
+	for _, c := range comments {
+		existingIDs[c.ID] = true
+		if c.Source != "" {
+			idOf[c.Source] = c.ID
+		}
+	}
+	sourceKey := func(id string) string { return format + ":" + id }
+
+	var added []Comment
+	postIDOf := make(map[string]string) // 新评论 ID -> 文章 ID
+	for _, item := range items {
+		post := postOf[item.Thread]
+		if post == nil {
+			if u := unmatched[item.Thread]; u != nil {
+				u.Comments++
+			} else {
+				report.Skipped++
+			}
+			continue
+		}
+		key := sourceKey(item.SourceID)
+		if _, ok := idOf[key]; ok || (format == CommentFormatJSON && existingIDs[item.SourceID]) {
+			report.Duplicate++
+			continue
+		}
+
+		id := newULIDAt(item.CreatedAt)
+		if format == CommentFormatJSON && item.SourceID != "" && !existingIDs[item.SourceID] {
+			id = item.SourceID
+		}
+		existingIDs[id] = true
+		idOf[key] = id
+		postIDOf[id] = post.ID
+
+		added = append(added, Comment{
+			ID:          id,
+			PostID:      post.ID,
+			PostSlug:    post.Slug,
+			Author:      item.Author,
+			Email:       item.Email,
+			Content:     item.Content,
+			ContentHTML: RenderCommentMarkdown(item.Content),
+			CreatedAt:   item.CreatedAt,
+			Approved:    item.Approved && !item.Spam,
+			ParentID:    item.ParentID, // 先记源 ID，下面统一换成本站 ID
+			IP:          item.IP,
+			Spam:        item.Spam,
+			Source:      key,
+		})
+	}
+
+	// 关联父评论：父评论可能在本次导入中，也可能之前已导入；不在同一篇文章的父评论丢弃
+	authorOf := make(map[string]string)
+	for _, c := range comments {
+		authorOf[c.ID] = c.Author
+		postIDOf[c.ID] = c.PostID
+	}
+	for _, c := range added {
+		authorOf[c.ID] = c.Author
+	}
+	for i := range added {
+		if added[i].ParentID == "" {
+			continue
+		}
+		parentID := idOf[sourceKey(added[i].ParentID)]
+		if format == CommentFormatJSON && parentID == "" && existingIDs[added[i].ParentID] {
+			parentID = added[i].ParentID
+		}
+		if parentID == "" || parentID == added[i].ID || postIDOf[parentID] != added[i].PostID {
+			added[i].ParentID = ""
+			continue
+		}
+		added[i].ParentID = parentID
+		added[i].ReplyTo = authorOf[parentID]
+	}
+
+	report.Imported = len(added)
+	for _, key := range unmatchedOrder {
+		report.Unmatched = append(report.Unmatched, *unmatched[key])
+	}
+
+	if dryRun || len(added) == 0 {
+		return report, nil
+	}
+	comments = append(comments, added...)
+	if err := saveComments(); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// ========== 文章匹配 ==========
+
+type threadMatcher struct {
+	byPath  map[string]*Post
+	bySlug  map[string][]*Post
+	byTitle map[string][]*Post
+}
+
+func newThreadMatcher() *threadMatcher {
+	m := &threadMatcher{
+		byPath:  make(map[string]*Post),
+		bySlug:  make(map[string][]*Post),
+		byTitle: make(map[string][]*Post),
+	}
+	for _, post := range currentSnapshot().byKey {
+		m.byPath[strings.ToLower(post.Permalink())] = post
+		slug := strings.ToLower(post.Slug)
+		m.bySlug[slug] = append(m.bySlug[slug], post)
+		title := strings.ToLower(strings.TrimSpace(post.Title))
+		m.byTitle[title] = append(m.byTitle[title], post)
+	}
+	return m
+}
+
+// match 依次按文章 ID、链接路径、slug、标题匹配；slug 和标题有歧义时视为未匹配
+func (m *threadMatcher) match(t importThread) *Post {
+	// Disqus 标识符可能就是本站导出的文章 ID
+	for _, id := range []string{t.PostID, t.Slug} {
+		if post := GetPostByID(id); id != "" && post != nil {
+			return post
+		}
+	}
+
+	var path string
+	if u, err := url.Parse(strings.TrimSpace(t.URL)); err == nil {
+		path = strings.ToLower(strings.TrimSuffix(u.Path, "/"))
+		if post := m.byPath[path]; post != nil {
+			return post
+		}
+	}
+
+	// 旧站链接通常以 slug 结尾，如 /2015/03/hello-world/ 或 /posts/hello-world.html
+	candidates := []string{t.Slug, path[strings.LastIndex(path, "/")+1:]}
+	for _, slug := range candidates {
+		slug = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(slug), ".html"))
+		if posts := m.bySlug[slug]; slug != "" && len(posts) == 1 {
+			return posts[0]
+		}
+	}
+
+	if posts := m.byTitle[strings.ToLower(strings.TrimSpace(t.Title))]; t.Title != "" && len(posts) == 1 {
+		return posts[0]
+	}
+	return nil
+}
+
+// ========== 解析 ==========
+
+func parseJSONComments(data []byte) ([]importThread, []importedComment, error) {
+	var list []exportedComment
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, nil, err
+	}
+
+	seen := make(map[string]bool)
+	var threads []importThread
+	var items []importedComment
+	for _, c := range list {
+		key := c.PostID
+		if key == "" {
+			key = c.PostURL + "|" + c.PostSlug
+		}
+		if !seen[key] {
+			seen[key] = true
+			threads = append(threads, importThread{
+				Key:    key,
+				PostID: c.PostID,
+				URL:    c.PostURL,
+				Title:  c.PostTitle,
+				Slug:   c.PostSlug,
+			})
+		}
+		items = append(items, importedComment{
+			SourceID:  c.ID,
+			ParentID:  c.ParentID,
+			Thread:    key,
+			Author:    c.Author,
+			Email:     c.Email,
+			IP:        c.IP,
+			Content:   c.Content,
+			CreatedAt: c.CreatedAt,
+			Approved:  c.Approved,
+			Spam:      c.Spam,
+		})
+	}
+	return threads, items, nil
+}
+
+// WXR 元素带 wp: 前缀，标签不写命名空间即可匹配任意版本（1.0~1.2）
+type wxrFile struct {
+	Items []struct {
+		Title    string       `xml:"title"`
+		Link     string       `xml:"link"`
+		PostID   string       `xml:"post_id"`
+		PostName string       `xml:"post_name"`
+		Comments []wxrComment `xml:"comment"`
+	} `xml:"channel>item"`
+}
+
+type wxrComment struct {
+	ID          string `xml:"comment_id"`
+	Author      string `xml:"comment_author"`
+	AuthorEmail string `xml:"comment_author_email"`
+	AuthorIP    string `xml:"comment_author_IP"`
+	Date        string `xml:"comment_date"`
+	DateGMT     string `xml:"comment_date_gmt"`
+	Content     string `xml:"comment_content"`
+	Approved    string `xml:"comment_approved"`
+	Type        string `xml:"comment_type"`
+	Parent      string `xml:"comment_parent"`
+}
+
+func parseWXRComments(data []byte) ([]importThread, []importedComment, int, error) {
+	var f wxrFile
+	if err := xml.Unmarshal(data, &f); err != nil {
+		return nil, nil, 0, err
+	}
+
+	var threads []importThread
+	var items []importedComment
+	skipped := 0
+	for i, item := range f.Items {
+		if len(item.Comments) == 0 {
+			continue
+		}
+		key := item.PostID
+		if key == "" {
+			key = fmt.Sprintf("item-%d", i)
+		}
+		threads = append(threads, importThread{Key: key, URL: item.Link, Title: item.Title, Slug: item.PostName})
+
+		for _, c := range item.Comments {
+			// pingback/trackback 不是读者评论；回收站里的评论不导入
+			if (c.Type != "" && c.Type != "comment") || c.Approved == "trash" {
+				skipped++
+				continue
+			}
+			parent := c.Parent
+			if parent == "0" {
+				parent = ""
+			}
+			items = append(items, importedComment{
+				SourceID:  c.ID,
+				ParentID:  parent,
+				Thread:    key,
+				Author:    strings.TrimSpace(c.Author),
+				Email:     strings.TrimSpace(c.AuthorEmail),
+				IP:        c.AuthorIP,
+				Content:   htmlToCommentMarkdown(c.Content),
+				CreatedAt: parseWXRDate(c.DateGMT, c.Date),
+				Approved:  c.Approved == "1",
+				Spam:      c.Approved == "spam",
+			})
+		}
+	}
+	return threads, items, skipped, nil
+}
+
+// parseWXRDate 优先使用 GMT 时间，旧版导出没有时按本地时间解析
+func parseWXRDate(gmt, local string) time.Time {
+	const layout = "2006-01-02 15:04:05"
+	if t, err := time.Parse(layout, gmt); err == nil && !strings.HasPrefix(gmt, "0000") {
+		return t
+	}
+	if t, err := time.ParseInLocation(layout, local, time.Local); err == nil {
+		return t
+	}
+	return time.Now()
+}
+
+// Disqus 导出文件：讨论串和评论平铺，评论通过 dsq:id 引用讨论串和父评论
+type disqusFile struct {
+	Threads []struct {
+		DsqID      string `xml:"id,attr"`
+		Identifier string `xml:"id"`
+		Link       string `xml:"link"`
+		Title      string `xml:"title"`
+	} `xml:"thread"`
+	Posts []struct {
+		DsqID     string `xml:"id,attr"`
+		Message   string `xml:"message"`
+		CreatedAt string `xml:"createdAt"`
+		IsDeleted bool   `xml:"isDeleted"`
+		IsSpam    bool   `xml:"isSpam"`
+		Author    struct {
+			Email    string `xml:"email"`
+			Name     string `xml:"name"`
+			Username string `xml:"username"`
+		} `xml:"author"`
+		IPAddress string `xml:"ipAddress"`
+		Thread    struct {
+			DsqID string `xml:"id,attr"`
+		} `xml:"thread"`
+		Parent struct {
+			DsqID string `xml:"id,attr"`
+		} `xml:"parent"`
+	} `xml:"post"`
+}
+
+func parseDisqusComments(data []byte) ([]importThread, []importedComment, int, error) {
+	var f disqusFile
+	if err := xml.Unmarshal(data, &f); err != nil {
+		return nil, nil, 0, err
+	}
+
+	threads := make([]importThread, 0, len(f.Threads))
+	for _, t := range f.Threads {
+		threads = append(threads, importThread{Key: t.DsqID, URL: t.Link, Title: t.Title, Slug: t.Identifier})
+	}
+
+	var items []importedComment
+	skipped := 0
+	for _, p := range f.Posts {
+		if p.IsDeleted {
+			skipped++
+			continue
+		}
+		author := strings.TrimSpace(p.Author.Name)
+		if author == "" {
+			author = p.Author.Username
+		}
+		createdAt, err := time.Parse(time.RFC3339, strings.TrimSpace(p.CreatedAt))
+		if err != nil {
+			createdAt = time.Now()
+		}
+		items = append(items, importedComment{
+			SourceID:  p.DsqID,
+			ParentID:  p.Parent.DsqID,
+			Thread:    p.Thread.DsqID,
+			Author:    author,
+			Email:     strings.TrimSpace(p.Author.Email),
+			IP:        p.IPAddress,
+			Content:   htmlToCommentMarkdown(p.Message),
+			CreatedAt: createdAt,
+			Approved:  !p.IsSpam,
+			Spam:      p.IsSpam,
+		})
+	}
+	return threads, items, skipped, nil
+}
+
+var (
+	reHTMLBreak     = regexp.MustCompile(`(?i)<br\s*/?>\n?`)
+	reHTMLParagraph = regexp.MustCompile(`(?i)</?p(\s[^>]*)?>`)
+	reHTMLLink      = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	reHTMLStrong    = regexp.MustCompile(`(?is)<(strong|b)>(.*?)</(strong|b)>`)
+	reHTMLEm        = regexp.MustCompile(`(?is)<(em|i)>(.*?)</(em|i)>`)
+	reHTMLCode      = regexp.MustCompile(`(?is)<code>(.*?)</code>`)
+	reHTMLTag       = regexp.MustCompile(`<[^>]*>`)
+	reBlankLines    = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToCommentMarkdown 将旧系统的评论 HTML 转为 Markdown，保留段落、换行、链接和强调，其余标签去掉
+func htmlToCommentMarkdown(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	s = reHTMLBreak.ReplaceAllString(s, "\n")
+	s = reHTMLParagraph.ReplaceAllString(s, "\n\n")
+	s = reHTMLLink.ReplaceAllStringFunc(s, func(m string) string {
+		parts := reHTMLLink.FindStringSubmatch(m)
+		href := html.UnescapeString(parts[1])
+		text := strings.TrimSpace(reHTMLTag.ReplaceAllString(parts[2], ""))
+		if text == "" || html.UnescapeString(text) == href {
+			return href
+		}
+		return "[" + text + "](" + href + ")"
+	})
+	s = reHTMLStrong.ReplaceAllString(s, "**$2**")
+	s = reHTMLEm.ReplaceAllString(s, "*$2*")
+	s = reHTMLCode.ReplaceAllString(s, "`$1`")
+	s = reHTMLTag.ReplaceAllString(s, "")
+	s = html.UnescapeString(s)
+	s = reBlankLines.ReplaceAllString(s, "\n\n")
+	return strings.TrimSpace(s)
+}
@@ -0,0 +1,198 @@
+package pkg
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// setupImportPosts tech/hello 和 life/hello 同 slug 同标题，tech/unique 唯一
+func setupImportPosts(t *testing.T) {
+	t.Helper()
+	setupTestDir(t)
+	writeTestPost(t, "tech", "hello", "id: 01HELLO\ntitle: Hello World\ndate: 2024-01-01", "a")
+	writeTestPost(t, "life", "hello", "id: 01LIFE\ntitle: Hello World\ndate: 2024-01-02", "b")
+	writeTestPost(t, "tech", "unique", "id: 01UNIQUE\ntitle: Unique Title\ndate: 2024-01-03", "c")
+	loadTestPosts(t)
+	setTestComments(t, nil)
+}
+
+func TestThreadMatcherMatch(t *testing.T) {
+	setupImportPosts(t)
+	m := newThreadMatcher()
+
+	tests := []struct {
+		name   string
+		thread importThread
+		want   string // 文章 ID，空表示未匹配
+	}{
+		{"post id", importThread{PostID: "01HELLO", Slug: "unique"}, "01HELLO"},
+		{"disqus identifier is a post id", importThread{Slug: "01LIFE"}, "01LIFE"},
+		{"permalink", importThread{URL: "https://old.example.com/tech/hello.html"}, "01HELLO"},
+		{"permalink case and trailing slash", importThread{URL: "https://old.example.com/Life/Hello.html/"}, "01LIFE"},
+		{"slug at end of old url", importThread{URL: "https://old.example.com/2015/03/unique/"}, "01UNIQUE"},
+		{"slug with .html", importThread{Slug: "Unique.html"}, "01UNIQUE"},
+		{"title", importThread{Title: " unique title "}, "01UNIQUE"},
+		{"ambiguous slug and title", importThread{Slug: "hello", Title: "Hello World"}, ""},
+		{"unknown post id falls through to url", importThread{PostID: "01GONE", URL: "/tech/unique.html"}, "01UNIQUE"},
+		{"nothing matches", importThread{URL: "https://old.example.com/about/", Title: "About"}, ""},
+		{"empty thread", importThread{}, ""},
+	}
+	for _, tt := range tests {
+		got := ""
+		if post := m.match(tt.thread); post != nil {
+			got = post.ID
+		}
+		if got != tt.want {
+			t.Errorf("%s: matched %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseJSONComments(t *testing.T) {
+	data, _ := json.Marshal([]exportedComment{
+		{Comment: Comment{ID: "c1", PostID: "01HELLO", Content: "a"}},
+		{Comment: Comment{ID: "c2", PostID: "01HELLO", ParentID: "c1", Content: "b"}},
+		{Comment: Comment{ID: "c3", PostSlug: "old"}, PostURL: "https://old.example.com/old.html", PostTitle: "Old"},
+		{Comment: Comment{ID: "c4", PostSlug: "old"}, PostURL: "https://old.example.com/old.html"},
+	})
+	threads, items, err := parseJSONComments(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantThreads := []importThread{
+		{Key: "01HELLO", PostID: "01HELLO"},
+		{Key: "https://old.example.com/old.html|old", URL: "https://old.example.com/old.html", Title: "Old", Slug: "old"},
+	}
+	if len(threads) != len(wantThreads) {
+		t.Fatalf("got %d threads, want %d: %+v", len(threads), len(wantThreads), threads)
+	}
+	for i, want := range wantThreads {
+		if threads[i] != want {
+			t.Errorf("thread %d = %+v, want %+v", i, threads[i], want)
+		}
+	}
+
+	wantItems := []struct{ source, parent, thread string }{
+		{"c1", "", "01HELLO"},
+		{"c2", "c1", "01HELLO"},
+		{"c3", "", "https://old.example.com/old.html|old"},
+		{"c4", "", "https://old.example.com/old.html|old"},
+	}
+	for i, want := range wantItems {
+		if got := items[i]; got.SourceID != want.source || got.ParentID != want.parent || got.Thread != want.thread {
+			t.Errorf("item %d = %s/%s/%s, want %s/%s/%s", i, got.SourceID, got.ParentID, got.Thread, want.source, want.parent, want.thread)
+		}
+	}
+
+	if _, _, err := parseJSONComments([]byte("{")); err == nil {
+		t.Error("invalid JSON did not return an error")
+	}
+}
+
+const testWXR = `<?xml version="1.0" encoding="UTF-8"?>
+<rss xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+<item>
+	<title>Unique Title</title>
+	<link>https://old.example.com/2015/03/unique/</link>
+	<wp:post_id>7</wp:post_id>
+	<wp:post_name>unique</wp:post_name>
+	<wp:comment>
+		<wp:comment_id>1</wp:comment_id>
+		<wp:comment_author>Alice</wp:comment_author>
+		<wp:comment_date_gmt>2015-03-01 10:00:00</wp:comment_date_gmt>
+		<wp:comment_content>First</wp:comment_content>
+		<wp:comment_approved>1</wp:comment_approved>
+		<wp:comment_parent>0</wp:comment_parent>
+	</wp:comment>
+	<wp:comment>
+		<wp:comment_id>2</wp:comment_id>
+		<wp:comment_author>Bob</wp:comment_author>
+		<wp:comment_date_gmt>2015-03-01 11:00:00</wp:comment_date_gmt>
+		<wp:comment_content>Reply</wp:comment_content>
+		<wp:comment_approved>1</wp:comment_approved>
+		<wp:comment_parent>1</wp:comment_parent>
+	</wp:comment>
+	<wp:comment>
+		<wp:comment_id>3</wp:comment_id>
+		<wp:comment_type>pingback</wp:comment_type>
+		<wp:comment_approved>1</wp:comment_approved>
+	</wp:comment>
+</item>
+<item>
+	<title>Gone</title>
+	<link>https://old.example.com/gone/</link>
+	<wp:post_id>8</wp:post_id>
+	<wp:comment>
+		<wp:comment_id>4</wp:comment_id>
+		<wp:comment_approved>1</wp:comment_approved>
+	</wp:comment>
+</item>
+</channel>
+</rss>`
+
+func TestImportCommentsDedupe(t *testing.T) {
+	setupImportPosts(t)
+
+	if f := DetectCommentFormat([]byte(testWXR)); f != CommentFormatWXR {
+		t.Fatalf("DetectCommentFormat = %q, want wxr", f)
+	}
+
+	dry, err := ImportComments([]byte(testWXR), "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.Imported != 2 || len(GetAllComments()) != 0 {
+		t.Errorf("dry run: imported=%d, stored=%d, want 2, 0", dry.Imported, len(GetAllComments()))
+	}
+
+	report, err := ImportComments([]byte(testWXR), "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 4 || report.Imported != 2 || report.Skipped != 1 || report.Duplicate != 0 {
+		t.Errorf("first import: %+v", report)
+	}
+	if len(report.Unmatched) != 1 || report.Unmatched[0].Title != "Gone" || report.Unmatched[0].Comments != 1 {
+		t.Errorf("unmatched = %+v", report.Unmatched)
+	}
+
+	list := GetAllComments() // 按时间倒序
+	if len(list) != 2 || list[0].PostID != "01UNIQUE" || list[1].PostID != "01UNIQUE" {
+		t.Fatalf("want 2 comments on the matched post, got %+v", list)
+	}
+	reply, first := list[0], list[1]
+	if first.Source != "wxr:1" || reply.Source != "wxr:2" {
+		t.Errorf("sources = %q, %q, want wxr:1, wxr:2", first.Source, reply.Source)
+	}
+	if reply.ParentID != first.ID || reply.ReplyTo != "Alice" {
+		t.Errorf("reply parent = %q (%q), want %q (Alice)", reply.ParentID, reply.ReplyTo, first.ID)
+	}
+	if want := time.Date(2015, 3, 1, 10, 0, 0, 0, time.UTC); !first.CreatedAt.Equal(want) {
+		t.Errorf("created at = %v, want %v", first.CreatedAt, want)
+	}
+
+	// 再次导入同一文件：全部按 Source 识别为重复
+	again, err := ImportComments([]byte(testWXR), CommentFormatWXR, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Imported != 0 || again.Duplicate != 2 || len(GetAllComments()) != 2 {
+		t.Errorf("second import: imported=%d duplicate=%d stored=%d", again.Imported, again.Duplicate, len(GetAllComments()))
+	}
+
+	// 导出的 JSON 再导入：按评论 ID 去重
+	data, err := ExportComments(CommentFormatJSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := ImportComments(data, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fromJSON.Imported != 0 || fromJSON.Duplicate != 2 {
+		t.Errorf("json reimport: imported=%d duplicate=%d", fromJSON.Imported, fromJSON.Duplicate)
+	}
+}
@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// 评论 Markdown：不渲染原始 HTML，只允许 http/https/mailto 链接，链接统一加 rel="nofollow ugc"，
+// 渲染结果再经过白名单过滤，双重保证不会引入脚本
+
+var (
+	commentMD     goldmark.Markdown
+	commentPolicy *bluemonday.Policy
+)
+
+// initCommentMarkdown 初始化评论渲染器和 HTML 白名单，由 InitMarkdown 调用
+func initCommentMarkdown() {
+	commentMD = goldmark.New(
+		goldmark.WithExtensions(extension.Linkify, extension.Strikethrough),
+		goldmark.WithRendererOptions(
+			html.WithHardWraps(),
+			renderer.WithNodeRenderers(util.Prioritized(&commentRenderer{}, 100)),
+		),
+	)
+
+	p := bluemonday.NewPolicy()
+	p.AllowElements("p", "br", "strong", "em", "del", "blockquote", "ul", "ol", "li", "pre", "code", "hr")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	p.AllowAttrs("href").OnElements("a")
+	p.AllowAttrs("rel").Matching(regexp.MustCompile(`^nofollow ugc$`)).OnElements("a")
+	p.AllowURLSchemes("http", "https", "mailto")
+	p.RequireParseableURLs(true)
+	commentPolicy = p
+}
+
+// RenderCommentMarkdown 将评论内容渲染为安全的 HTML
+func RenderCommentMarkdown(content string) string {
+	var buf bytes.Buffer
+	if err := commentMD.Convert([]byte(content), &buf); err != nil {
+		return "<p>" + escapeHTML(content) + "</p>"
+	}
+	return commentPolicy.Sanitize(buf.String())
+}
+
+func escapeHTML(s string) string {
+	return string(util.EscapeHTML([]byte(s)))
+}
+
+// safeCommentURL 只放行 http、https 和 mailto 链接
+func safeCommentURL(dest string) bool {
+	u, err := url.Parse(strings.TrimSpace(dest))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	}
+	return false
+}
+
+// commentRenderer 评论专用渲染：不安全的链接只输出文字，安全链接加 rel="nofollow ugc"；
+// 图片降级为链接，避免评论里嵌入外部图片；原始 HTML 按文字原样显示；标题降级为段落
+type commentRenderer struct{}
+
+func (r *commentRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindLink, r.renderLink)
+	reg.Register(ast.KindAutoLink, r.renderAutoLink)
+	reg.Register(ast.KindImage, r.renderImage)
+	reg.Register(ast.KindRawHTML, r.renderRawHTML)
+	reg.Register(ast.KindHTMLBlock, r.renderHTMLBlock)
+	reg.Register(ast.KindHeading, r.renderHeading)
+}
+
+func (r *commentRenderer) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	for i := 0; i < n.Segments.Len(); i++ {
+		seg := n.Segments.At(i)
+		w.Write(util.EscapeHTML(seg.Value(source)))
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *commentRenderer) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.HTMLBlock)
+	w.WriteString("<p>")
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		if i > 0 {
+			w.WriteString("<br>\n")
+		}
+		seg := lines.At(i)
+		w.Write(util.EscapeHTML(bytes.TrimRight(seg.Value(source), "\r\n")))
+	}
+	if n.HasClosure() {
+		w.WriteString("<br>\n")
+		w.Write(util.EscapeHTML(bytes.TrimRight(n.ClosureLine.Value(source), "\r\n")))
+	}
+	w.WriteString("</p>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *commentRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		w.WriteString("<p><strong>")
+	} else {
+		w.WriteString("</strong></p>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func writeCommentLinkOpen(w util.BufWriter, dest []byte) {
+	w.WriteString(`<a href="`)
+	w.Write(util.EscapeHTML(util.URLEscape(dest, true)))
+	w.WriteString(`" rel="nofollow ugc">`)
+}
+
+func (r *commentRenderer) renderLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*ast.Link)
+	if !safeCommentURL(string(n.Destination)) {
+		return ast.WalkContinue, nil
+	}
+	if entering {
+		writeCommentLinkOpen(w, n.Destination)
+	} else {
+		w.WriteString("</a>")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *commentRenderer) renderAutoLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.AutoLink)
+	dest := n.URL(source)
+	label := n.Label(source)
+	if n.AutoLinkType == ast.AutoLinkEmail && !bytes.HasPrefix(bytes.ToLower(dest), []byte("mailto:")) {
+		dest = append([]byte("mailto:"), dest...)
+	}
+	if !safeCommentURL(string(dest)) {
+		w.Write(util.EscapeHTML(label))
+		return ast.WalkContinue, nil
+	}
+	writeCommentLinkOpen(w, dest)
+	w.Write(util.EscapeHTML(label))
+	w.WriteString("</a>")
+	return ast.WalkContinue, nil
+}
+
+func (r *commentRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.Image)
+	safe := safeCommentURL(string(n.Destination))
+	if safe {
+		writeCommentLinkOpen(w, n.Destination)
+	}
+	writeTexts(w, source, n)
+	if safe {
+		w.WriteString("</a>")
+	}
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+)
+
+func commentPostInfo(c Comment) (title, link string) {
+	title, link = c.PostSlug, strings.TrimSuffix(AppConfig.Site.BaseURL, "/")
+	if post := GetPostByID(c.PostID); post != nil {
+		title = post.Title
+		link += post.Permalink()
+	}
+	return title, link
+}
+
+// notifyAdmin 新评论（含待审核）通知管理员，垃圾评论不通知
+func notifyAdmin(c Comment) {
+	admin := AppConfig.Mail.AdminEmail
+	if admin == "" || c.Spam || strings.EqualFold(admin, c.Email) {
+		return
+	}
+	title, link := commentPostInfo(c)
+
+	subject := fmt.Sprintf("[%s] 《%s》有新评论", AppConfig.Site.Title, title)
+	status := "已发布"
+	if !c.Approved {
+		subject = fmt.Sprintf("[%s] 《%s》有新评论待审核", AppConfig.Site.Title, title)
+		status = "待审核"
+	}
+	body := fmt.Sprintf("%s 在《%s》发表了评论（%s）：\n\n%s\n\n文章：%s\n管理评论：%s/admin/comments\n",
+		c.Author, title, status, c.Content, link, strings.TrimSuffix(AppConfig.Site.BaseURL, "/"))
+	EnqueueMail(&MailMessage{To: admin, Subject: subject, Body: body})
+}
+
+// notifyReply 已发布的回复通知被回复的评论者，parent 为被回复的评论
+func notifyReply(c Comment, parent *Comment) {
+	if !AppConfig.Mail.NotifyReplies || parent == nil || !c.Approved {
+		return
+	}
+	to := parent.Email
+	if to == "" || strings.EqualFold(to, c.Email) || IsUnsubscribed(to) {
+		return
+	}
+	title, link := commentPostInfo(c)
+	unsubscribe := UnsubscribeURL(to)
+
+	subject := fmt.Sprintf("[%s] %s 回复了你在《%s》的评论", AppConfig.Site.Title, c.Author, title)
+	body := fmt.Sprintf("%s 你好，\n\n%s 回复了你的评论：\n\n%s\n\n你的评论：\n%s\n\n查看文章：%s\n\n不想再收到回复通知？点此退订：%s\n",
+		parent.Author, c.Author, c.Content, parent.Content, link, unsubscribe)
+	EnqueueMail(&MailMessage{To: to, Subject: subject, Body: body, Unsubscribe: unsubscribe})
+}
+
+// findComment 按 ID 查找评论，调用方需持有 commentsLock
+func findComment(id string) *Comment {
+	if id == "" {
+		return nil
+	}
+	for i := range comments {
+		if comments[i].ID == id {
+			c := comments[i]
+			return &c
+		}
+	}
+	return nil
+}
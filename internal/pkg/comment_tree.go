@@ -0,0 +1,246 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sort"
+	"time"
+)
+
+// 评论排序方式
+const (
+	CommentSortOldest  = "oldest"  // 最早的在前（默认）
+	CommentSortNewest  = "newest"  // 最新的在前
+	CommentSortReplies = "replies" // 回复最多的在前
+)
+
+// crockford Crockford Base32 字母表（ULID 使用的编码）
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID 生成 ULID：48 位毫秒时间戳 + 80 位随机数，按时间有序且不会在同一秒内重复，
+// 用作评论和文章的 ID
+func NewULID() string {
+	return newULIDAt(time.Now())
+}
+
+// newULIDAt 以指定时间生成 ULID，导入旧评论时保持 ID 与评论时间一致
+func newULIDAt(t time.Time) string {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(t.UnixMilli())<<16)
+	rand.Read(b[6:])
+
+	var out [26]byte
+	// 128 位按 5 位一组编码，最高位补两个 0 位
+	var acc uint64
+	bits := 2
+	pos := 0
+	for _, v := range b {
+		acc = acc<<8 | uint64(v)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			out[pos] = crockford[(acc>>uint(bits))&31]
+			pos++
+		}
+	}
+	return string(out[:])
+}
+
+// CommentPage 一页顶级评论（每条带完整的回复树）
+type CommentPage struct {
+	Comments   []Comment
+	Threads    int // 顶级评论数
+	Total      int // 已发布评论总数（含回复）
+	Page       int
+	TotalPages int
+	Sort       string
+}
+
+// HasPrev 是否有上一页
+func (p CommentPage) HasPrev() bool { return p.Page > 1 }
+
+// HasNext 是否有下一页
+func (p CommentPage) HasNext() bool { return p.Page < p.TotalPages }
+
+// PrevPage 上一页页码
+func (p CommentPage) PrevPage() int { return p.Page - 1 }
+
+// NextPage 下一页页码
+func (p CommentPage) NextPage() int { return p.Page + 1 }
+
+func commentMaxDepth() int {
+	d := AppConfig.Comments.MaxDepth
+	if d <= 0 {
+		d = 3
+	}
+	if d > 10 {
+		d = 10
+	}
+	return d
+}
+
+func commentsPerPage() int {
+	if n := AppConfig.Comments.PerPage; n > 0 {
+		return n
+	}
+	return 50
+}
+
+// normalizeCommentSort 校验排序参数，无效时使用配置的默认值
+func normalizeCommentSort(s string) string {
+	switch s {
+	case CommentSortOldest, CommentSortNewest, CommentSortReplies:
+		return s
+	}
+	switch AppConfig.Comments.Sort {
+	case CommentSortNewest, CommentSortReplies:
+		return AppConfig.Comments.Sort
+	}
+	return CommentSortOldest
+}
+
+// GetCommentPage 获取文章某一页的评论树，page 从 1 开始
+func GetCommentPage(postID string, page int, sortBy string) CommentPage {
+	sortBy = normalizeCommentSort(sortBy)
+	threads, total := buildCommentTree(postID, sortBy)
+
+	perPage := commentsPerPage()
+	totalPages := (len(threads) + perPage - 1) / perPage
+	if totalPages < 1 {
+		totalPages = 1
+	}
+	if page < 1 {
+		page = 1
+	}
+	if page > totalPages {
+		page = totalPages
+	}
+	start := (page - 1) * perPage
+	end := start + perPage
+	if end > len(threads) {
+		end = len(threads)
+	}
+
+	return CommentPage{
+		Comments:   threads[start:end],
+		Threads:    len(threads),
+		Total:      total,
+		Page:       page,
+		TotalPages: totalPages,
+		Sort:       sortBy,
+	}
+}
+
+// buildCommentTree 构建文章的评论树，返回排序后的顶级评论和已发布评论总数
+func buildCommentTree(postID, sortBy string) ([]Comment, int) {
+	commentsLock.RLock()
+	var all []*Comment
+	for i := range comments {
+		if comments[i].PostID == postID && comments[i].Approved && !comments[i].Spam {
+			c := comments[i] // 复制一份
+			c.Replies = nil
+			all = append(all, &c)
+		}
+	}
+	commentsLock.RUnlock()
+
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].CreatedAt.Before(all[j].CreatedAt)
+	})
+
+	byID := make(map[string]*Comment, len(all))
+	for _, c := range all {
+		byID[c.ID] = c
+	}
+	children := make(map[string][]*Comment)
+	var roots []*Comment
+	for _, c := range all {
+		// 父评论不存在（已删除或未审核）时作为顶级评论
+		if _, ok := byID[c.ParentID]; c.ParentID == "" || c.ParentID == c.ID || !ok {
+			roots = append(roots, c)
+			continue
+		}
+		children[c.ParentID] = append(children[c.ParentID], c)
+	}
+
+	maxDepth := commentMaxDepth()
+	threads := make([]Comment, 0, len(roots))
+	for _, root := range roots {
+		thread := *root
+		thread.Depth = 0
+		thread.Replies = buildReplies(root.ID, children, 1, maxDepth)
+		threads = append(threads, thread)
+	}
+
+	switch sortBy {
+	case CommentSortNewest:
+		sort.SliceStable(threads, func(i, j int) bool {
+			return threads[i].CreatedAt.After(threads[j].CreatedAt)
+		})
+	case CommentSortReplies:
+		sort.SliceStable(threads, func(i, j int) bool {
+			return threads[i].ReplyCount() > threads[j].ReplyCount()
+		})
+	}
+	return threads, len(all)
+}
+
+// buildReplies 递归构建回复；到达最大深度后，更深的回复按时间顺序平铺在最后一层
+func buildReplies(parentID string, children map[string][]*Comment, depth, maxDepth int) []Comment {
+	kids := children[parentID]
+	if depth >= maxDepth {
+		kids = collectDescendants(parentID, children, make(map[string]bool))
+		sort.SliceStable(kids, func(i, j int) bool {
+			return kids[i].CreatedAt.Before(kids[j].CreatedAt)
+		})
+	}
+
+	replies := make([]Comment, 0, len(kids))
+	for _, k := range kids {
+		c := *k
+		c.Depth = depth
+		if depth < maxDepth {
+			c.Replies = buildReplies(k.ID, children, depth+1, maxDepth)
+		}
+		replies = append(replies, c)
+	}
+	return replies
+}
+
+func collectDescendants(parentID string, children map[string][]*Comment, seen map[string]bool) []*Comment {
+	var result []*Comment
+	for _, c := range children[parentID] {
+		if seen[c.ID] {
+			continue
+		}
+		seen[c.ID] = true
+		result = append(result, c)
+		result = append(result, collectDescendants(c.ID, children, seen)...)
+	}
+	return result
+}
+
+// ReplyCount 回复总数（含所有层级）
+func (c Comment) ReplyCount() int {
+	n := len(c.Replies)
+	for _, r := range c.Replies {
+		n += r.ReplyCount()
+	}
+	return n
+}
+
+// Thread 按先序展开所有回复（模板不便递归渲染时使用），Depth 表示缩进层级
+func (c Comment) Thread() []Comment {
+	var result []Comment
+	for _, r := range c.Replies {
+		result = append(result, r)
+		result = append(result, r.Thread()...)
+	}
+	return result
+}
+
+// parentInPost 父评论是否存在且属于同一篇文章，调用方需持有 commentsLock
+func parentInPost(parentID, postID string) bool {
+	parent := findComment(parentID)
+	return parent != nil && parent.PostID == postID
+}
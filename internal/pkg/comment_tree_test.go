@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testComment 生成一条已发布评论，minute 决定创建时间的先后
+func testComment(id, parentID string, minute int) Comment {
+	return Comment{
+		ID:        id,
+		PostID:    "01POST",
+		ParentID:  parentID,
+		Approved:  true,
+		CreatedAt: time.Date(2024, 1, 1, 0, minute, 0, 0, time.UTC),
+	}
+}
+
+// outline 将评论树写成 a(b(c) d) e 的形式，便于比较结构
+func outline(list []Comment) string {
+	var parts []string
+	for _, c := range list {
+		s := c.ID
+		if len(c.Replies) > 0 {
+			s += "(" + outline(c.Replies) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildCommentTree(t *testing.T) {
+	spam := testComment("spam", "", 9)
+	spam.Spam = true
+	pending := testComment("pending", "", 2)
+	pending.Approved = false
+	other := testComment("other", "", 3)
+	other.PostID = "01OTHER"
+
+	tests := []struct {
+		name     string
+		comments []Comment
+		maxDepth int
+		sort     string
+		want     string
+		total    int
+	}{
+		{
+			name: "nested replies in time order",
+			comments: []Comment{
+				testComment("a", "", 1), testComment("c", "b", 4), testComment("b", "a", 3),
+				testComment("d", "a", 5), testComment("e", "", 2),
+			},
+			want:  "a(b(c) d) e",
+			total: 5,
+		},
+		{
+			name: "replies past max depth are flattened in time order",
+			comments: []Comment{
+				testComment("a", "", 1), testComment("b", "a", 2), testComment("c", "b", 3),
+				testComment("d", "c", 5), testComment("e", "b", 4),
+			},
+			maxDepth: 2,
+			want:     "a(b(c e d))",
+			total:    5,
+		},
+		{
+			name: "hidden parents, spam and other posts",
+			comments: []Comment{
+				pending, testComment("orphan", "pending", 4), spam, other,
+				testComment("self", "self", 5), testComment("a", "", 1),
+			},
+			want:  "a orphan self",
+			total: 3,
+		},
+		{
+			name: "newest first",
+			comments: []Comment{
+				testComment("a", "", 1), testComment("b", "", 2), testComment("r", "a", 3),
+			},
+			sort:  CommentSortNewest,
+			want:  "b a(r)",
+			total: 3,
+		},
+		{
+			name: "most replies first, ties keep time order",
+			comments: []Comment{
+				testComment("a", "", 1), testComment("b", "", 2), testComment("c", "", 3),
+				testComment("r1", "c", 4), testComment("r2", "r1", 5), testComment("r3", "b", 6),
+			},
+			sort:  CommentSortReplies,
+			want:  "c(r1(r2)) b(r3) a",
+			total: 6,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDir(t)
+			AppConfig.Comments.MaxDepth = tt.maxDepth
+			setTestComments(t, tt.comments)
+
+			threads, total := buildCommentTree("01POST", normalizeCommentSort(tt.sort))
+			if got := outline(threads); got != tt.want {
+				t.Errorf("tree = %q, want %q", got, tt.want)
+			}
+			if total != tt.total {
+				t.Errorf("total = %d, want %d", total, tt.total)
+			}
+		})
+	}
+}
+
+func TestGetCommentPage(t *testing.T) {
+	setupTestDir(t)
+	AppConfig.Comments.PerPage = 2
+
+	var list []Comment
+	for i := 1; i <= 5; i++ {
+		list = append(list, testComment(fmt.Sprintf("t%d", i), "", i))
+	}
+	list = append(list, testComment("r", "t1", 10))
+	setTestComments(t, list)
+
+	tests := []struct {
+		page     int
+		wantPage int
+		want     string
+		hasPrev  bool
+		hasNext  bool
+	}{
+		{0, 1, "t1(r) t2", false, true},
+		{1, 1, "t1(r) t2", false, true},
+		{2, 2, "t3 t4", true, true},
+		{3, 3, "t5", true, false},
+		{9, 3, "t5", true, false},
+	}
+	for _, tt := range tests {
+		p := GetCommentPage("01POST", tt.page, "")
+		if p.Page != tt.wantPage || outline(p.Comments) != tt.want {
+			t.Errorf("page %d: got page %d %q, want page %d %q", tt.page, p.Page, outline(p.Comments), tt.wantPage, tt.want)
+		}
+		if p.HasPrev() != tt.hasPrev || p.HasNext() != tt.hasNext {
+			t.Errorf("page %d: HasPrev/HasNext = %v/%v, want %v/%v", tt.page, p.HasPrev(), p.HasNext(), tt.hasPrev, tt.hasNext)
+		}
+		if p.Threads != 5 || p.Total != 6 || p.TotalPages != 3 || p.Sort != CommentSortOldest {
+			t.Errorf("page %d: got threads=%d total=%d pages=%d sort=%s", tt.page, p.Threads, p.Total, p.TotalPages, p.Sort)
+		}
+	}
+
+	// 没有评论时仍返回第 1 页
+	if p := GetCommentPage("01EMPTY", 3, ""); p.Page != 1 || p.TotalPages != 1 || len(p.Comments) != 0 {
+		t.Errorf("empty post: got page %d of %d with %d comments", p.Page, p.TotalPages, len(p.Comments))
+	}
+}
+
+func TestNormalizeCommentSort(t *testing.T) {
+	setupTestDir(t)
+	tests := []struct {
+		param, configured, want string
+	}{
+		{"newest", "", CommentSortNewest},
+		{"replies", "newest", CommentSortReplies},
+		{"", "newest", CommentSortNewest},
+		{"bogus", "replies", CommentSortReplies},
+		{"bogus", "bogus", CommentSortOldest},
+		{"", "", CommentSortOldest},
+	}
+	for _, tt := range tests {
+		AppConfig.Comments.Sort = tt.configured
+		if got := normalizeCommentSort(tt.param); got != tt.want {
+			t.Errorf("normalizeCommentSort(%q) with default %q = %q, want %q", tt.param, tt.configured, got, tt.want)
+		}
+	}
+}
@@ -1,10 +1,11 @@
 package pkg
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/spf13/viper"
 )
@@ -14,6 +15,14 @@ type Config struct {
 	Theme         string
 	PostsPerPage  int `mapstructure:"posts_per_page"`
 	Search        SearchConfig
+	Images        ImageConfig
+	Comments      CommentsConfig
+	Mail          MailConfig
+	Webmention    WebmentionConfig
+	Stats         StatsConfig
+	Metrics       MetricsConfig
+	Log           LogConfig
+	Cache         CacheConfig
 	Server        ServerConfig
 	Admin         AdminConfig
 	AdminUsername string
@@ -68,6 +77,92 @@ type SearchConfig struct {
 	IndexPath string `mapstructure:"index_path"`
 }
 
+// ImageConfig 图片缩放配置
+type ImageConfig struct {
+	Widths   []int  // 生成的宽度，默认 480/960/1600
+	Quality  int    // JPEG 质量，默认 82
+	Sizes    string // img 的 sizes 属性
+	CacheDir string `mapstructure:"cache_dir"` // 缩放图片缓存目录，默认 data/image-cache
+}
+
+// 评论审核模式
+const (
+	ModerationOff       = "off"        // 直接发布
+	ModerationFirstTime = "first_time" // 首次评论需审核
+	ModerationAll       = "all"        // 全部需审核
+)
+
+// CommentsConfig 评论审核与反垃圾配置
+type CommentsConfig struct {
+	Moderation      string   // off / first_time / all
+	MinSubmitTime   int      `mapstructure:"min_submit_time"`  // 打开页面到提交的最短秒数，0 使用默认值 3，-1 关闭
+	RateLimit       int      `mapstructure:"rate_limit"`       // 每个 IP 在 rate_window 内最多提交次数
+	RateWindow      int      `mapstructure:"rate_window"`      // 限流窗口（秒）
+	MaxLinks        int      `mapstructure:"max_links"`        // 超过该链接数视为垃圾评论，0 表示不限制
+	BlockedKeywords []string `mapstructure:"blocked_keywords"` // 命中即视为垃圾评论
+	BannedIPs       []string `mapstructure:"banned_ips"`
+	BannedEmails    []string `mapstructure:"banned_emails"`
+	PoW             bool     `mapstructure:"pow"`            // 提交评论前需在浏览器完成工作量证明
+	PoWDifficulty   int      `mapstructure:"pow_difficulty"` // 前导零位数，默认 16，每加 1 计算量翻倍
+	MaxDepth        int      `mapstructure:"max_depth"`      // 回复最大嵌套层数，默认 3，更深的回复平铺在最后一层
+	PerPage         int      `mapstructure:"per_page"`       // 每页顶级评论数，默认 50
+	Sort            string   // 默认排序：oldest / newest / replies
+	EditWindow      int      `mapstructure:"edit_window"` // 评论者可修改、删除自己评论的时限（分钟），默认 15，-1 关闭
+}
+
+// 邮件连接加密方式
+const (
+	MailSecurityAuto     = ""         // 服务器支持时使用 STARTTLS
+	MailSecurityNone     = "none"     // 明文
+	MailSecurityStartTLS = "starttls" // 必须 STARTTLS
+	MailSecurityTLS      = "tls"      // 直接 TLS（通常为 465 端口）
+)
+
+// MailConfig SMTP 邮件通知配置
+type MailConfig struct {
+	Enabled       bool
+	Host          string
+	Port          int
+	Username      string
+	Password      string
+	From          string
+	Security      string // 空 / none / starttls / tls
+	AdminEmail    string `mapstructure:"admin_email"`    // 接收新评论通知的邮箱
+	NotifyReplies bool   `mapstructure:"notify_replies"` // 评论被回复时通知原评论者
+}
+
+// WebmentionConfig Webmention 收发配置
+type WebmentionConfig struct {
+	Enabled      bool // 接收 Webmention，并在文章页声明接收端点
+	Send         bool // 发布或保存文章时向文中链接的站点发送 Webmention
+	AllowPrivate bool `mapstructure:"allow_private"` // 允许访问内网和本机地址（仅用于测试）
+}
+
+// StatsConfig 访问统计配置
+type StatsConfig struct {
+	RetentionDays int    `mapstructure:"retention_days"` // 按天、按文章保留明细的天数，默认 400，最少 365，更早的按月汇总
+	APIToken      string `mapstructure:"api_token"`      // /api/stats 的访问令牌，为空时只允许已登录的管理员
+}
+
+// MetricsConfig Prometheus 指标配置，开启后需设置令牌或单独的监听地址，否则不暴露 /metrics
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled"`
+	Token   string `mapstructure:"token"`  // 主端口 /metrics 的 Bearer 令牌
+	Listen  string `mapstructure:"listen"` // 单独的监听地址，如 127.0.0.1:9100，设置后 /metrics 只在该地址提供
+}
+
+// CacheConfig 前台整页缓存配置
+type CacheConfig struct {
+	Pages bool `mapstructure:"pages"` // 缓存渲染后的前台页面，内容、评论或后台设置变化时自动失效
+	TTL   int  `mapstructure:"ttl"`   // 页面缓存有效期（秒），0 表示一直有效直到失效
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	Level  string `mapstructure:"level"`  // debug、info、warn、error，默认 info
+	Format string `mapstructure:"format"` // text 或 json，默认 text
+}
+
 var AppConfig Config
 
 // ContentBasePath 内容目录的基础路径
@@ -77,11 +172,13 @@ func InitConfig() {
 	// Load config.yaml
 	viper.SetConfigFile("config.yaml")
 	if err := viper.ReadInConfig(); err != nil {
-		log.Fatalf("Error reading config file, %s", err)
+		slog.Error("error reading config file", "err", err)
+		os.Exit(1)
 	}
 
 	if err := viper.Unmarshal(&AppConfig); err != nil {
-		log.Fatalf("Unable to decode into struct, %v", err)
+		slog.Error("unable to decode config", "err", err)
+		os.Exit(1)
 	}
 
 	// 从 config.yaml 读取配置
@@ -103,6 +200,22 @@ func InitConfig() {
 	if envSecret := os.Getenv("JWT_SECRET"); envSecret != "" {
 		AppConfig.JWTSecret = envSecret
 	}
+	if envMailPass := os.Getenv("SMTP_PASSWORD"); envMailPass != "" {
+		AppConfig.Mail.Password = envMailPass
+	}
+	if envStatsToken := os.Getenv("STATS_API_TOKEN"); envStatsToken != "" {
+		AppConfig.Stats.APIToken = envStatsToken
+	}
+	if envMetricsToken := os.Getenv("METRICS_TOKEN"); envMetricsToken != "" {
+		AppConfig.Metrics.Token = envMetricsToken
+	}
+	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
+		AppConfig.Log.Level = envLogLevel
+	}
+	if envLogFormat := os.Getenv("LOG_FORMAT"); envLogFormat != "" {
+		AppConfig.Log.Format = envLogFormat
+	}
+	InitLogger()
 	
 	// 默认端口
 	if AppConfig.Port == "" {
@@ -111,7 +224,7 @@ func InitConfig() {
 
 	// 校验管理员凭据
 	if AppConfig.AdminUsername == "" || AppConfig.AdminPassword == "" {
-		log.Println("WARNING: admin username or password not set, admin panel will be inaccessible")
+		slog.Warn("admin username or password not set, admin panel will be inaccessible")
 	}
 
 	// 初始化内容基础路径（用于路径安全校验）
@@ -199,6 +312,92 @@ func UpdateFeaturesConfig(commentsEnabled, tocEnabled, readingTimeEnabled bool)
 	return viper.WriteConfig()
 }
 
+// UpdateCommentsConfig 更新评论审核与反垃圾配置
+func UpdateCommentsConfig(moderation string, minSubmitTime, rateLimit, rateWindow, maxLinks, editWindow int, blockedKeywords []string) error {
+	AppConfig.Comments.Moderation = moderation
+	AppConfig.Comments.MinSubmitTime = minSubmitTime
+	AppConfig.Comments.RateLimit = rateLimit
+	AppConfig.Comments.RateWindow = rateWindow
+	AppConfig.Comments.MaxLinks = maxLinks
+	AppConfig.Comments.EditWindow = editWindow
+	AppConfig.Comments.BlockedKeywords = blockedKeywords
+
+	viper.Set("comments.moderation", moderation)
+	viper.Set("comments.min_submit_time", minSubmitTime)
+	viper.Set("comments.rate_limit", rateLimit)
+	viper.Set("comments.rate_window", rateWindow)
+	viper.Set("comments.max_links", maxLinks)
+	viper.Set("comments.edit_window", editWindow)
+	viper.Set("comments.blocked_keywords", blockedKeywords)
+
+	return viper.WriteConfig()
+}
+
+// UpdatePoWConfig 更新评论工作量证明配置
+func UpdatePoWConfig(enabled bool, difficulty int) error {
+	AppConfig.Comments.PoW = enabled
+	AppConfig.Comments.PoWDifficulty = difficulty
+
+	viper.Set("comments.pow", enabled)
+	viper.Set("comments.pow_difficulty", difficulty)
+
+	return viper.WriteConfig()
+}
+
+// UpdateMailConfig 更新邮件通知配置，password 为空时保留原密码
+func UpdateMailConfig(cfg MailConfig) error {
+	if cfg.Password == "" {
+		cfg.Password = AppConfig.Mail.Password
+	}
+	AppConfig.Mail = cfg
+
+	viper.Set("mail.enabled", cfg.Enabled)
+	viper.Set("mail.host", cfg.Host)
+	viper.Set("mail.port", cfg.Port)
+	viper.Set("mail.username", cfg.Username)
+	if os.Getenv("SMTP_PASSWORD") == "" { // 来自环境变量的密码不写入配置文件
+		viper.Set("mail.password", cfg.Password)
+	}
+	viper.Set("mail.from", cfg.From)
+	viper.Set("mail.security", cfg.Security)
+	viper.Set("mail.admin_email", cfg.AdminEmail)
+	viper.Set("mail.notify_replies", cfg.NotifyReplies)
+
+	return viper.WriteConfig()
+}
+
+// UpdateWebmentionConfig 更新 Webmention 收发配置
+func UpdateWebmentionConfig(enabled, send bool) error {
+	AppConfig.Webmention.Enabled = enabled
+	AppConfig.Webmention.Send = send
+
+	viper.Set("webmention.enabled", enabled)
+	viper.Set("webmention.send", send)
+
+	return viper.WriteConfig()
+}
+
+// commentBansLock 保护 AppConfig.Comments 中的黑名单，评论提交时会并发读取
+var commentBansLock sync.RWMutex
+
+// UpdateCommentBans 更新评论黑名单
+func UpdateCommentBans(ips, emails []string) error {
+	commentBansLock.Lock()
+	defer commentBansLock.Unlock()
+	return updateCommentBans(ips, emails)
+}
+
+// updateCommentBans 调用方需持有 commentBansLock 写锁
+func updateCommentBans(ips, emails []string) error {
+	AppConfig.Comments.BannedIPs = ips
+	AppConfig.Comments.BannedEmails = emails
+
+	viper.Set("comments.banned_ips", ips)
+	viper.Set("comments.banned_emails", emails)
+
+	return viper.WriteConfig()
+}
+
 // UpdateFooterConfig 更新页脚配置
 func UpdateFooterConfig(copyright, icp string, links []FooterLink) error {
 	AppConfig.Site.Footer.Copyright = copyright
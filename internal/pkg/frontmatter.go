@@ -0,0 +1,176 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// knownMetaKeys 已由 Post 字段承载的 front matter 键，其余键会放入 Params
+var knownMetaKeys = map[string]bool{
+	"id":          true,
+	"title":       true,
+	"date":        true,
+	"updated":     true,
+	"lastmod":     true,
+	"tags":        true,
+	"draft":       true,
+	"pinned":      true,
+	"slug":        true,
+	"cover":       true,
+	"layout":      true,
+	"author":      true,
+	"description": true,
+	"keywords":    true,
+	"weight":      true,
+	"params":      true,
+}
+
+// dateLayouts 支持的日期格式，按从精确到宽松的顺序尝试
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04 -0700",
+	"2006-01-02 15:04 -07:00",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+// ParseDate 解析 front matter 中的日期，支持时间和时区；
+// 不带时区的值按本地时区解释
+func ParseDate(value interface{}) (time.Time, error) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return time.Time{}, fmt.Errorf("empty date")
+		}
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+	case int:
+		// YAML 中的 Unix 时间戳
+		return time.Unix(int64(v), 0), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported date type %T", value)
+	}
+}
+
+// metaString 读取字符串类型的 front matter 值
+func metaString(metaData map[string]interface{}, key string) string {
+	switch v := metaData[key].(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case int, int64, float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// metaStringList 读取列表或逗号分隔字符串类型的 front matter 值
+func metaStringList(metaData map[string]interface{}, key string) []string {
+	var result []string
+	switch v := metaData[key].(type) {
+	case []interface{}:
+		for _, item := range v {
+			if s := strings.TrimSpace(fmt.Sprint(item)); s != "" {
+				result = append(result, s)
+			}
+		}
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if s := strings.TrimSpace(item); s != "" {
+				result = append(result, s)
+			}
+		}
+	}
+	return result
+}
+
+// metaInt 读取整数类型的 front matter 值
+func metaInt(metaData map[string]interface{}, key string) int {
+	switch v := metaData[key].(type) {
+	case int:
+		return v
+	case int64:
+		return int(v)
+	case float64:
+		return int(v)
+	case string:
+		n, _ := strconv.Atoi(strings.TrimSpace(v))
+		return n
+	}
+	return 0
+}
+
+// buildParams 汇总 params 下的键和未识别的顶层键，供模板通过 Post.Params 访问
+func buildParams(metaData map[string]interface{}) map[string]interface{} {
+	params := make(map[string]interface{})
+	if nested, ok := normalizeMetaValue(metaData["params"]).(map[string]interface{}); ok {
+		for k, v := range nested {
+			params[k] = v
+		}
+	}
+	for k, v := range metaData {
+		if knownMetaKeys[k] {
+			continue
+		}
+		if _, exists := params[k]; !exists {
+			params[k] = normalizeMetaValue(v)
+		}
+	}
+	return params
+}
+
+// normalizeMetaValue 将 YAML 解析出的 map[interface{}]interface{} 转为模板可访问的 map[string]interface{}
+func normalizeMetaValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[fmt.Sprint(k)] = normalizeMetaValue(item)
+		}
+		return m
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			m[k] = normalizeMetaValue(item)
+		}
+		return m
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i, item := range v {
+			list[i] = normalizeMetaValue(item)
+		}
+		return list
+	}
+	return value
+}
+
+// ResolveLayout 根据 front matter 的 layout 选择主题模板，模板不存在时使用 fallback
+func ResolveLayout(layout, fallback string) string {
+	layout = strings.TrimSuffix(strings.TrimSpace(layout), ".html")
+	if layout == "" || strings.ContainsAny(layout, `/\`) || strings.Contains(layout, "..") {
+		return fallback
+	}
+	name := layout + ".html"
+	if _, err := os.Stat(filepath.Join("themes", AppConfig.Theme, "layouts", name)); err != nil {
+		return fallback
+	}
+	return name
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 健康检查用到的内容加载状态
+var (
+	storeReady atomic.Bool // 首次载入文章和建立搜索索引是否完成
+
+	reloadLock     sync.RWMutex
+	lastReloadAt   time.Time
+	lastReloadErr  string // 内容目录无法读取等导致整次载入失败的错误
+	lastSkipped    int    // 解析失败被跳过的文件数
+	lastSkippedErr string // 第一个解析失败的文件及原因
+)
+
+// ContentStatus 内容载入状态
+type ContentStatus struct {
+	Ready       bool      `json:"ready"`
+	Posts       int       `json:"posts"`
+	Drafts      int       `json:"drafts"`
+	LastReload  time.Time `json:"last_reload"`
+	LastError   string    `json:"-"` // 含文件路径，不在公开的健康检查中输出，详情见日志
+	Skipped     int       `json:"skipped,omitempty"`
+	SkippedInfo string    `json:"-"`
+}
+
+// recordReload 记录一次载入的结果，由 LoadAllPosts 调用
+func recordReload(walkErr error, skipped int, firstSkipped string) {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+	lastReloadAt = time.Now()
+	lastReloadErr = ""
+	if walkErr != nil {
+		lastReloadErr = walkErr.Error()
+	}
+	lastSkipped = skipped
+	lastSkippedErr = firstSkipped
+}
+
+// GetContentStatus 返回内容载入状态
+func GetContentStatus() ContentStatus {
+	published, drafts := PostCounts()
+
+	reloadLock.RLock()
+	defer reloadLock.RUnlock()
+	return ContentStatus{
+		Ready:       storeReady.Load() && searchReady(),
+		Posts:       published,
+		Drafts:      drafts,
+		LastReload:  lastReloadAt,
+		LastError:   lastReloadErr,
+		Skipped:     lastSkipped,
+		SkippedInfo: lastSkippedErr,
+	}
+}
+
+// CheckDataWritable 检查 data 目录能否写入
+func CheckDataWritable() error {
+	if err := os.MkdirAll("data", 0755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp("data", ".health-*")
+	if err != nil {
+		return fmt.Errorf("data 目录不可写: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setupTestDir 切换到临时目录（data、content 等相对路径都落在这里），测试结束后恢复配置
+func setupTestDir(t testing.TB) {
+	t.Helper()
+	saved := AppConfig
+	t.Cleanup(func() { AppConfig = saved })
+	t.Chdir(t.TempDir())
+	os.MkdirAll("data", 0755)
+	AppConfig.Search.IndexPath = filepath.Join(t.TempDir(), "index")
+}
+
+// writeTestPost 在 content/blog/<category> 下写一篇文章，frontMatter 不含分隔线
+func writeTestPost(t *testing.T, category, slug, frontMatter, body string) string {
+	t.Helper()
+	path := filepath.Join("content", "blog", category, slug+".md")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	content := "---\n" + frontMatter + "\n---\n\n" + body + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadTestPosts 载入 content/blog 下的文章并建立搜索索引
+func loadTestPosts(t *testing.T) {
+	t.Helper()
+	InitMarkdown()
+	LoadAllPosts()
+	InitSearchIndex()
+}
+
+// setTestComments 替换内存中的评论列表，测试结束后恢复
+func setTestComments(t testing.TB, list []Comment) {
+	t.Helper()
+	commentsLock.Lock()
+	saved := comments
+	comments = list
+	commentsLock.Unlock()
+	t.Cleanup(func() {
+		commentsLock.Lock()
+		comments = saved
+		commentsLock.Unlock()
+	})
+}
@@ -0,0 +1,223 @@
+package pkg
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif" // 注册 GIF 解码器，用于读取尺寸
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // 注册 WebP 解码器
+)
+
+// ResizedURLPrefix 缩放图片的访问路径前缀，对应 images.cache_dir
+const ResizedURLPrefix = "/resized/"
+
+// ImageVariant 图片的一个缩放版本
+type ImageVariant struct {
+	Width int
+	URL   string
+}
+
+// ImageInfo 图片尺寸和可用的缩放版本（按宽度升序）
+type ImageInfo struct {
+	Width    int
+	Height   int
+	Variants []ImageVariant
+}
+
+// cachedImageInfo 图片信息及对应的文件修改时间，文件修改后重新计算并覆盖
+type cachedImageInfo struct {
+	modTime time.Time
+	info    *ImageInfo
+}
+
+var (
+	imageInfoCache sync.Map // 文件路径 -> cachedImageInfo
+	imageLocks     sync.Map // 同一图片的缩放串行执行
+)
+
+// resizableExts 支持生成缩放版本的格式；SVG 和 GIF（可能是动图）保持原样
+var resizableExts = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+func imageWidths() []int {
+	widths := AppConfig.Images.Widths
+	if len(widths) == 0 {
+		widths = []int{480, 960, 1600}
+	}
+	sorted := append([]int(nil), widths...)
+	sort.Ints(sorted)
+	return sorted
+}
+
+func imageQuality() int {
+	if q := AppConfig.Images.Quality; q > 0 && q <= 100 {
+		return q
+	}
+	return 82
+}
+
+// ImageCacheDir 缩放图片的缓存目录
+func ImageCacheDir() string {
+	if AppConfig.Images.CacheDir != "" {
+		return AppConfig.Images.CacheDir
+	}
+	return filepath.Join("data", "image-cache")
+}
+
+// variantPath 返回缩放版本的磁盘路径和 URL；PNG 保留透明通道，其余格式统一输出 JPEG。
+// 文件名保留原扩展名（foo.webp-480w.jpg），避免 foo.jpg 和 foo.webp 的缩放版本互相覆盖
+func variantPath(srcURL string, width int) (string, string) {
+	rel := strings.TrimPrefix(srcURL, "/")
+	ext := strings.ToLower(filepath.Ext(rel))
+	outExt := ".jpg"
+	if ext == ".png" {
+		outExt = ".png"
+	}
+	name := fmt.Sprintf("%s-%dw%s", rel, width, outExt)
+	return filepath.Join(ImageCacheDir(), filepath.FromSlash(name)), ResizedURLPrefix + name
+}
+
+// GetImageInfo 获取上传图片的尺寸，并按需生成缩放版本；非上传图片或无法解码时返回 nil
+func GetImageInfo(srcURL string) *ImageInfo {
+	file := uploadFilePath(srcURL)
+	if file == "" {
+		return nil
+	}
+	stat, err := os.Stat(file)
+	if err != nil {
+		return nil
+	}
+
+	if val, ok := imageInfoCache.Load(file); ok {
+		if cached := val.(cachedImageInfo); cached.modTime.Equal(stat.ModTime()) {
+			return cached.info
+		}
+	}
+
+	info, err := processImage(file, srcURL)
+	if err != nil {
+		slog.Error("image processing failed", "file", file, "err", err)
+		return nil
+	}
+	imageInfoCache.Store(file, cachedImageInfo{modTime: stat.ModTime(), info: info})
+	return info
+}
+
+// ProcessUploadedImage 上传后立即生成缩放版本
+func ProcessUploadedImage(srcURL string) {
+	GetImageInfo(srcURL)
+}
+
+func processImage(file, srcURL string) (*ImageInfo, error) {
+	lock, _ := imageLocks.LoadOrStore(file, &sync.Mutex{})
+	lock.(*sync.Mutex).Lock()
+	defer lock.(*sync.Mutex).Unlock()
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	info := &ImageInfo{Width: cfg.Width, Height: cfg.Height}
+
+	ext := strings.ToLower(filepath.Ext(file))
+	if !resizableExts[ext] {
+		return info, nil
+	}
+
+	srcStat, _ := f.Stat()
+	var src image.Image
+	for _, width := range imageWidths() {
+		if width >= cfg.Width {
+			break
+		}
+		outPath, url := variantPath(srcURL, width)
+
+		// 已生成且比原图新则直接复用
+		if st, err := os.Stat(outPath); err == nil && !st.ModTime().Before(srcStat.ModTime()) {
+			info.Variants = append(info.Variants, ImageVariant{Width: width, URL: url})
+			continue
+		}
+
+		if src == nil {
+			if _, err := f.Seek(0, 0); err != nil {
+				return nil, err
+			}
+			if src, _, err = image.Decode(f); err != nil {
+				return nil, err
+			}
+		}
+		if err := writeResized(src, outPath, width, cfg.Width, cfg.Height); err != nil {
+			return nil, err
+		}
+		info.Variants = append(info.Variants, ImageVariant{Width: width, URL: url})
+	}
+	return info, nil
+}
+
+// writeResized 按宽度等比缩放并写入文件（先写临时文件再重命名）。
+// JPEG 没有透明通道，带透明的 WebP 等先铺上白色背景，避免透明处变黑
+func writeResized(src image.Image, outPath string, width, srcWidth, srcHeight int) error {
+	height := srcHeight * width / srcWidth
+	if height < 1 {
+		height = 1
+	}
+	isPNG := filepath.Ext(outPath) == ".png"
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	if !isPNG {
+		draw.Draw(dst, dst.Bounds(), image.White, image.Point{}, draw.Src)
+	}
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+
+	if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(outPath), ".resize-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if isPNG {
+		err = png.Encode(tmp, dst)
+	} else {
+		err = jpeg.Encode(tmp, dst, &jpeg.Options{Quality: imageQuality()})
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), outPath)
+}
+
+// Srcset 生成 img 标签的 srcset 属性值，最后一项为原图
+func (info *ImageInfo) Srcset(srcURL string) string {
+	if len(info.Variants) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(info.Variants)+1)
+	for _, v := range info.Variants {
+		parts = append(parts, fmt.Sprintf("%s %dw", v.URL, v.Width))
+	}
+	parts = append(parts, fmt.Sprintf("%s %dw", srcURL, info.Width))
+	return strings.Join(parts, ", ")
+}
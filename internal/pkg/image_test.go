@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestPNG(t *testing.T, path string, width, height int, c color.Color) {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	os.MkdirAll(filepath.Dir(path), 0755)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVariantPathKeepsSourceExtension(t *testing.T) {
+	setupTestDir(t)
+	seen := make(map[string]string)
+	for _, src := range []string{"/uploads/foo.jpg", "/uploads/foo.jpeg", "/uploads/foo.webp", "/uploads/foo.png"} {
+		path, url := variantPath(src, 480)
+		if other, ok := seen[path]; ok {
+			t.Errorf("%s and %s share variant %s", src, other, path)
+		}
+		seen[path] = src
+		if filepath.Base(path) != filepath.Base(url) {
+			t.Errorf("%s: path %s and url %s differ", src, path, url)
+		}
+	}
+	if _, url := variantPath("/uploads/a/foo.webp", 480); url != ResizedURLPrefix+"uploads/a/foo.webp-480w.jpg" {
+		t.Errorf("url = %s", url)
+	}
+}
+
+func TestWriteResizedFlattensTransparencyForJPEG(t *testing.T) {
+	setupTestDir(t)
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 50)) // 全透明
+
+	out := filepath.Join("data", "out.jpg")
+	if err := writeResized(src, out, 40, 100, 50); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	img, err := jpeg.Decode(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+		t.Errorf("size = %v, want 40x20", b)
+	}
+	if r, g, b, _ := img.At(20, 10).RGBA(); r>>8 < 250 || g>>8 < 250 || b>>8 < 250 {
+		t.Errorf("transparent pixel became (%d, %d, %d), want white", r>>8, g>>8, b>>8)
+	}
+}
+
+func TestImageInfoCacheReplacesEntryOnChange(t *testing.T) {
+	setupTestDir(t)
+	AppConfig.Images.Widths = []int{50}
+	file := filepath.Join("uploads", "cache.png")
+
+	writeTestPNG(t, file, 100, 80, color.White)
+	if info := GetImageInfo("/uploads/cache.png"); info == nil || info.Width != 100 || len(info.Variants) != 1 {
+		t.Fatalf("info = %+v", info)
+	}
+
+	writeTestPNG(t, file, 200, 80, color.White)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(file, later, later)
+	if info := GetImageInfo("/uploads/cache.png"); info == nil || info.Width != 200 {
+		t.Fatalf("info after edit = %+v", info)
+	}
+
+	entries := 0
+	imageInfoCache.Range(func(key, _ any) bool {
+		if key == file {
+			entries++
+		}
+		return true
+	})
+	if entries != 1 {
+		t.Errorf("%d cache entries for %s, want 1", entries, file)
+	}
+}
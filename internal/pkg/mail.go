@@ -0,0 +1,277 @@
+package pkg
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage 待发送的邮件
+type MailMessage struct {
+	To          string
+	Subject     string
+	Body        string // 纯文本
+	Unsubscribe string // 退订链接，写入 List-Unsubscribe 头
+
+	attempts int
+}
+
+// 发送失败后的重试间隔，用完即放弃
+var mailRetryDelays = []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+var (
+	mailQueue chan *MailMessage
+
+	unsubscribed     = make(map[string]bool)
+	unsubscribedLock sync.RWMutex
+	unsubscribedFile = "data/unsubscribed.json"
+
+	unsubscribeKeyFile = "data/unsubscribe.key"
+	unsubscribeKeyOnce sync.Once
+	unsubscribeKey     []byte
+)
+
+// InitMail 初始化邮件队列，后台协程负责发送和重试
+func InitMail() {
+	os.MkdirAll("data", 0755)
+	loadUnsubscribed()
+
+	mailQueue = make(chan *MailMessage, 100)
+	go mailWorker()
+}
+
+// EnqueueMail 将邮件加入发送队列，不阻塞调用方；未启用或队列已满时返回 false
+func EnqueueMail(msg *MailMessage) bool {
+	if !AppConfig.Mail.Enabled || mailQueue == nil || msg.To == "" {
+		return false
+	}
+	select {
+	case mailQueue <- msg:
+		return true
+	default:
+		slog.Warn("mail queue full, dropping mail", "to", msg.To)
+		return false
+	}
+}
+
+func mailWorker() {
+	for msg := range mailQueue {
+		err := SendMail(msg)
+		if err == nil {
+			continue
+		}
+		if msg.attempts >= len(mailRetryDelays) {
+			slog.Error("mail failed", "to", msg.To, "attempts", msg.attempts+1, "err", err)
+			continue
+		}
+		delay := mailRetryDelays[msg.attempts]
+		msg.attempts++
+		slog.Warn("mail failed, retrying", "to", msg.To, "retry_in", delay, "err", err)
+		time.AfterFunc(delay, func() { EnqueueMail(msg) })
+	}
+}
+
+// SendMail 通过 SMTP 立即发送邮件
+func SendMail(msg *MailMessage) error {
+	cfg := AppConfig.Mail
+	if cfg.Host == "" {
+		return errors.New("未配置 SMTP 服务器")
+	}
+	port := cfg.Port
+	if port == 0 {
+		port = 587
+		if cfg.Security == MailSecurityTLS {
+			port = 465
+		}
+	}
+	from := cfg.From
+	if from == "" {
+		from = cfg.Username
+	}
+
+	addr := net.JoinHostPort(cfg.Host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	var err error
+	if cfg.Security == MailSecurityTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: cfg.Host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	client, err := smtp.NewClient(conn, cfg.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if cfg.Security != MailSecurityTLS && cfg.Security != MailSecurityNone {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: cfg.Host}); err != nil {
+				return err
+			}
+		} else if cfg.Security == MailSecurityStartTLS {
+			return errors.New("SMTP 服务器不支持 STARTTLS")
+		}
+	}
+	if cfg.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", cfg.Username, cfg.Password, cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err := client.Mail(mailAddress(from)); err != nil {
+		return err
+	}
+	if err := client.Rcpt(msg.To); err != nil {
+		return err
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(buildMailData(from, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// mailAddress 从 "名称 <addr>" 中取出邮箱地址
+func mailAddress(from string) string {
+	if i := strings.LastIndex(from, "<"); i >= 0 {
+		return strings.TrimSuffix(strings.TrimSpace(from[i+1:]), ">")
+	}
+	return from
+}
+
+func buildMailData(from string, msg *MailMessage) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	if msg.Unsubscribe != "" {
+		fmt.Fprintf(&buf, "List-Unsubscribe: <%s>\r\n", msg.Unsubscribe)
+	}
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(msg.Body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// ========== 退订 ==========
+
+func loadUnsubscribed() {
+	unsubscribedLock.Lock()
+	defer unsubscribedLock.Unlock()
+
+	data, err := os.ReadFile(unsubscribedFile)
+	if err != nil {
+		return
+	}
+	var emails []string
+	json.Unmarshal(data, &emails)
+	for _, email := range emails {
+		unsubscribed[email] = true
+	}
+}
+
+// IsUnsubscribed 邮箱是否已退订回复通知
+func IsUnsubscribed(email string) bool {
+	unsubscribedLock.RLock()
+	defer unsubscribedLock.RUnlock()
+	return unsubscribed[strings.ToLower(email)]
+}
+
+// Unsubscribe 退订回复通知
+func Unsubscribe(email string) error {
+	unsubscribedLock.Lock()
+	defer unsubscribedLock.Unlock()
+
+	unsubscribed[strings.ToLower(email)] = true
+	emails := make([]string, 0, len(unsubscribed))
+	for e := range unsubscribed {
+		emails = append(emails, e)
+	}
+	data, err := json.MarshalIndent(emails, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(unsubscribedFile, data, 0644)
+}
+
+// unsubscribeSecret 退订链接签名密钥。退订链接随邮件发出后长期有效，
+// 配置了 JWT 密钥时与表单令牌相同（已发出的链接继续有效），
+// 否则使用保存在 data 目录下的随机密钥，重启后旧链接仍然可用
+func unsubscribeSecret() []byte {
+	unsubscribeKeyOnce.Do(func() {
+		if AppConfig.JWTSecret != "" {
+			unsubscribeKey = commentFormSecret()
+			return
+		}
+		if data, err := os.ReadFile(unsubscribeKeyFile); err == nil {
+			if key, err := hex.DecodeString(strings.TrimSpace(string(data))); err == nil && len(key) >= 32 {
+				unsubscribeKey = key
+				return
+			}
+		}
+		unsubscribeKey = make([]byte, 32)
+		rand.Read(unsubscribeKey)
+		os.MkdirAll(filepath.Dir(unsubscribeKeyFile), 0755)
+		if err := writeFileAtomic(unsubscribeKeyFile, []byte(hex.EncodeToString(unsubscribeKey)), 0600); err != nil {
+			slog.Error("failed to save unsubscribe key", "err", err)
+		}
+	})
+	return unsubscribeKey
+}
+
+// UnsubscribeToken 退订链接的签名，防止他人替别人退订
+func UnsubscribeToken(email string) string {
+	mac := hmac.New(sha256.New, unsubscribeSecret())
+	mac.Write([]byte("unsubscribe:" + strings.ToLower(email)))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// CheckUnsubscribeToken 校验退订链接签名
+func CheckUnsubscribeToken(email, token string) bool {
+	return email != "" && hmac.Equal([]byte(token), []byte(UnsubscribeToken(email)))
+}
+
+// UnsubscribeURL 生成退订链接
+func UnsubscribeURL(email string) string {
+	return fmt.Sprintf("%s/comment/unsubscribe?email=%s&token=%s",
+		strings.TrimSuffix(AppConfig.Site.BaseURL, "/"), url.QueryEscape(email), UnsubscribeToken(email))
+}
@@ -0,0 +1,220 @@
+package pkg
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSMTP 本地 SMTP 替身，前 failFirst 次投递在 RCPT 阶段返回 451
+type fakeSMTP struct {
+	ln        net.Listener
+	failFirst int
+
+	mu       sync.Mutex
+	attempts int
+	messages []string
+	received chan struct{}
+}
+
+func newFakeSMTP(t *testing.T, failFirst int) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeSMTP{ln: ln, failFirst: failFirst, received: make(chan struct{}, 10)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250-localhost")
+			reply("250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			s.mu.Lock()
+			s.attempts++
+			fail := s.attempts <= s.failFirst
+			s.mu.Unlock()
+			if fail {
+				reply("451 try again later")
+			} else {
+				reply("250 OK")
+			}
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+			s.received <- struct{}{}
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func (s *fakeSMTP) wait(t *testing.T) *mail.Message {
+	t.Helper()
+	select {
+	case <-s.received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	msg, err := mail.ReadMessage(strings.NewReader(s.messages[len(s.messages)-1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func setupMail(t *testing.T, server *fakeSMTP) {
+	t.Helper()
+	setupTestDir(t)
+	AppConfig.Site.Title = "测试博客"
+	AppConfig.Site.BaseURL = "https://blog.example.com"
+	AppConfig.Mail = MailConfig{
+		Enabled:       true,
+		Host:          "127.0.0.1",
+		Port:          server.port(),
+		Security:      MailSecurityNone,
+		From:          "Blog <blog@example.com>",
+		AdminEmail:    "admin@example.com",
+		NotifyReplies: true,
+	}
+	unsubscribeKeyOnce = sync.Once{}
+	InitMail()
+}
+
+func mailBody(t *testing.T, msg *mail.Message) string {
+	t.Helper()
+	raw, err := io.ReadAll(msg.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(raw), "\r\n", ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestNotifyReplySendsMail(t *testing.T) {
+	server := newFakeSMTP(t, 0)
+	setupMail(t, server)
+
+	parent := &Comment{ID: "p1", Author: "张三", Email: "zhang@example.com", Content: "原评论"}
+	reply := Comment{ID: "c1", ParentID: "p1", Author: "李四", Email: "li@example.com", Content: "回复内容", Approved: true}
+	notifyReply(reply, parent)
+
+	msg := server.wait(t)
+	if to := msg.Header.Get("To"); to != "zhang@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(subject, "李四 回复了你") {
+		t.Errorf("Subject = %q", subject)
+	}
+	if body := mailBody(t, msg); !strings.Contains(body, "回复内容") || !strings.Contains(body, "原评论") {
+		t.Errorf("body missing comment text: %q", body)
+	}
+
+	link := strings.Trim(msg.Header.Get("List-Unsubscribe"), "<>")
+	if link != UnsubscribeURL("zhang@example.com") {
+		t.Errorf("List-Unsubscribe = %q", link)
+	}
+	if !CheckUnsubscribeToken("zhang@example.com", UnsubscribeToken("zhang@example.com")) {
+		t.Error("unsubscribe token rejected")
+	}
+}
+
+func TestMailRetriesAfterFailure(t *testing.T) {
+	server := newFakeSMTP(t, 2)
+	saved := mailRetryDelays
+	mailRetryDelays = []time.Duration{10 * time.Millisecond, 10 * time.Millisecond, 10 * time.Millisecond}
+	t.Cleanup(func() { mailRetryDelays = saved })
+	setupMail(t, server)
+
+	notifyAdmin(Comment{ID: "c1", Author: "李四", Email: "li@example.com", Content: "待审核的评论"})
+
+	msg := server.wait(t)
+	if to := msg.Header.Get("To"); to != "admin@example.com" {
+		t.Errorf("To = %q", to)
+	}
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.attempts != 3 {
+		t.Errorf("attempts = %d, want 3", server.attempts)
+	}
+}
+
+func TestUnsubscribeTokenSurvivesRestart(t *testing.T) {
+	setupTestDir(t)
+	AppConfig.JWTSecret = ""
+
+	unsubscribeKeyOnce = sync.Once{}
+	token := UnsubscribeToken("Zhang@Example.com")
+
+	// 模拟重启：重新读取密钥
+	unsubscribeKeyOnce = sync.Once{}
+	if !CheckUnsubscribeToken("zhang@example.com", token) {
+		t.Error("token from previous process rejected")
+	}
+	if CheckUnsubscribeToken("other@example.com", token) {
+		t.Error("token accepted for another address")
+	}
+}
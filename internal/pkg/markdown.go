@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -18,6 +19,7 @@ import (
 )
 
 type Post struct {
+	ID          string                 // 稳定 ID（front matter id），评论、统计和搜索以此关联文章
 	Title       string
 	Slug        string
 	Date        time.Time
@@ -26,11 +28,43 @@ type Post struct {
 	Content     string
 	Summary     string
 	FilePath    string
-	ReadingTime int       // 阅读时间（分钟）
-	WordCount   int       // 字数统计
-	TOC         []TOCItem // 文章目录
-	Draft       bool      // 是否为草稿
-	Pinned      bool      // 是否置顶
+	ReadingTime int                    // 阅读时间（分钟）
+	WordCount   int                    // 字数统计
+	TOC         []TOCItem              // 文章目录
+	Draft       bool                   // 是否为草稿
+	Pinned      bool                   // 是否置顶
+	Updated     time.Time              // 最后更新时间（updated / lastmod）
+	Cover       string                 // 封面图
+	Layout      string                 // 自定义模板名，对应主题 layouts 下的 <layout>.html
+	Author      string                 // 作者，为空时使用站点作者
+	Description string                 // SEO 描述，为空时使用摘要
+	Keywords    []string               // SEO 关键词
+	Weight      int                    // 排序权重
+	Params      map[string]interface{} // 其余自定义参数
+	Features    PostFeatures           // 公式、图表等需要前端脚本的特性
+	WikiLinks   []string               // 文中 [[...]] 链接的目标
+	Backlinks   []*Post                `json:"-"` // 链接到本文的文章，载入后计算
+	ModTime     time.Time              `json:"-"` // 文件修改时间，用于 Last-Modified
+
+	legacyID bool // 没有 front matter id，ID 暂用 category/slug
+}
+
+// LastModified 返回文章最后修改时间，未设置 updated 时回退到发布日期
+func (p *Post) LastModified() time.Time {
+	if p.Updated.After(p.Date) {
+		return p.Updated
+	}
+	return p.Date
+}
+
+// IsUpdated 文章发布后是否有过更新（供模板判断）
+func (p *Post) IsUpdated() bool {
+	return p.Updated.After(p.Date)
+}
+
+// Permalink 文章的站内路径，如 /category/slug.html
+func (p *Post) Permalink() string {
+	return "/" + p.Category + "/" + p.Slug + ".html"
 }
 
 // TOCItem 目录项
@@ -46,41 +80,73 @@ func InitMarkdown() {
 	mdProcessor = goldmark.New(
 		goldmark.WithExtensions(
 			meta.Meta,
+			&diagramExtension{},
+			&wikiLinkExtension{},
+			&imageExtension{},
 		),
 		goldmark.WithRendererOptions(
 			html.WithUnsafe(),
 		),
 	)
+	initCommentMarkdown()
 }
 
 func ParseMarkdownFile(path string) (*Post, error) {
+	post, _, _, err := parseMarkdownFile(path)
+	return post, err
+}
+
+// parseMarkdownFile 解析文章，同时返回 front matter 原始字段和 YAML 错误（YAML 无法解析时按无 front matter 处理），
+// 供内容检查复用同一次解析
+func parseMarkdownFile(path string) (post *Post, metaData map[string]interface{}, metaErr error, err error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	var buf bytes.Buffer
 	context := parser.NewContext()
 	if err := mdProcessor.Convert(content, &buf, parser.WithContext(context)); err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
-	metaData := meta.Get(context)
+	metaData, metaErr = meta.TryGet(context)
+	if metaData == nil {
+		metaData = map[string]interface{}{}
+	}
 	
-	post := &Post{
-		Content:  buf.String(),
-		FilePath: path,
+	post = &Post{
+		Content:   buf.String(),
+		FilePath:  path,
+		Features:  featuresFromContext(context),
+		WikiLinks: wikiLinkTargets(context),
+	}
+	if info, err := os.Stat(path); err == nil {
+		post.ModTime = info.ModTime()
 	}
 
+	post.ID = metaString(metaData, "id")
+
 	if title, ok := metaData["title"].(string); ok {
 		post.Title = title
 	} else {
 		post.Title = filepath.Base(path)
 	}
 
-	if dateStr, ok := metaData["date"].(string); ok {
-		t, _ := time.Parse("2006-01-02", dateStr)
-		post.Date = t
+	if raw, ok := metaData["date"]; ok {
+		if t, err := ParseDate(raw); err == nil {
+			post.Date = t
+		}
+	}
+
+	// updated 优先，兼容 Hugo 的 lastmod
+	for _, key := range []string{"updated", "lastmod"} {
+		if raw, ok := metaData[key]; ok {
+			if t, err := ParseDate(raw); err == nil {
+				post.Updated = t
+				break
+			}
+		}
 	}
 
 	if tags, ok := metaData["tags"].([]interface{}); ok {
@@ -101,6 +167,14 @@ func ParseMarkdownFile(path string) (*Post, error) {
 		post.Pinned = pinned
 	}
 
+	post.Cover = metaString(metaData, "cover")
+	post.Layout = metaString(metaData, "layout")
+	post.Author = metaString(metaData, "author")
+	post.Description = metaString(metaData, "description")
+	post.Keywords = metaStringList(metaData, "keywords")
+	post.Weight = metaInt(metaData, "weight")
+	post.Params = buildParams(metaData)
+
 	// Category Logic: Calculate relative path from "content/blog"
 	// Example: content/blog/tech/go.md -> "tech"
 	// Example: content/blog/life.md -> "uncategorized"
@@ -135,8 +209,7 @@ func ParseMarkdownFile(path string) (*Post, error) {
 		post.Slug = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
 	}
 
-	// 打印加载日志，方便排查 404
-	fmt.Printf("[DEBUG] Loaded Post: Slug=%s, Category=%s, Path=%s\n", post.Slug, post.Category, path)
+	slog.Debug("loaded post", "slug", post.Slug, "category", post.Category, "path", path)
 
 	// 自动生成摘要
 	post.Summary = generateSummary(post.Content, 120)
@@ -147,7 +220,7 @@ func ParseMarkdownFile(path string) (*Post, error) {
 	// 生成目录并添加标题 ID
 	post.Content, post.TOC = generateTOC(post.Content)
 
-	return post, nil
+	return post, metaData, metaErr, nil
 }
 
 // generateSummary 从 HTML 内容中提取纯文本摘要
@@ -210,11 +283,11 @@ func CreatePostFile(category, title, slug string, draft bool) (string, error) {
 	// 构建 frontmatter
 	var content string
 	if draft {
-		content = fmt.Sprintf("---\ntitle: \"%s\"\ndate: %s\ndraft: true\ntags: []\n---\n\nStart writing here...", 
-			title, time.Now().Format("2006-01-02"))
+		content = fmt.Sprintf("---\nid: %s\ntitle: \"%s\"\ndate: %s\ndraft: true\ntags: []\n---\n\nStart writing here...", 
+			NewULID(), title, time.Now().Format("2006-01-02"))
 	} else {
-		content = fmt.Sprintf("---\ntitle: \"%s\"\ndate: %s\ntags: []\n---\n\nStart writing here...", 
-			title, time.Now().Format("2006-01-02"))
+		content = fmt.Sprintf("---\nid: %s\ntitle: \"%s\"\ndate: %s\ntags: []\n---\n\nStart writing here...", 
+			NewULID(), title, time.Now().Format("2006-01-02"))
 	}
 	
 	err := os.WriteFile(filePath, []byte(content), 0644)
@@ -307,5 +380,5 @@ func RenderMarkdownPreview(content string) string {
 	if err := mdProcessor.Convert([]byte(content), &buf, parser.WithContext(context)); err != nil {
 		return "<p>渲染失败</p>"
 	}
-	return buf.String()
+	return ResolveWikiLinks(buf.String())
 }
@@ -0,0 +1,299 @@
+package pkg
+
+import (
+	"bytes"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// PostFeatures 文章用到的需要前端运行时支持的特性，主题据此按需加载脚本
+type PostFeatures struct {
+	Math    bool // 包含 $...$ / $$...$$ 公式
+	Mermaid bool // 包含 ```mermaid 图表
+}
+
+var (
+	mathFeatureKey    = parser.NewContextKey()
+	mermaidFeatureKey = parser.NewContextKey()
+)
+
+// featuresFromContext 读取解析过程中记录的特性标记
+func featuresFromContext(pc parser.Context) PostFeatures {
+	return PostFeatures{
+		Math:    pc.Get(mathFeatureKey) != nil,
+		Mermaid: pc.Get(mermaidFeatureKey) != nil,
+	}
+}
+
+// ========== 数学公式 ==========
+
+// KindMathBlock 块级公式节点
+var KindMathBlock = ast.NewNodeKind("MathBlock")
+
+// MathBlock $$ ... $$ 块级公式
+type MathBlock struct {
+	ast.BaseBlock
+	singleLine bool // $$ x $$ 写在同一行，无需继续读取
+}
+
+func (n *MathBlock) Kind() ast.NodeKind { return KindMathBlock }
+
+func (n *MathBlock) IsRaw() bool { return true }
+
+func (n *MathBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// KindMathInline 行内公式节点
+var KindMathInline = ast.NewNodeKind("MathInline")
+
+// MathInline $...$ 行内公式
+type MathInline struct {
+	ast.BaseInline
+	Literal []byte
+	Display bool // 同一行内的 $$...$$
+}
+
+func (n *MathInline) Kind() ast.NodeKind { return KindMathInline }
+
+func (n *MathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Literal": string(n.Literal)}, nil)
+}
+
+type mathBlockParser struct{}
+
+func (p *mathBlockParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+func (p *mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+
+	node := &MathBlock{}
+	rest := bytes.TrimSpace(line[pos+2:])
+	if len(rest) == 0 {
+		reader.AdvanceToEOL()
+		pc.Set(mathFeatureKey, true)
+		return node, parser.NoChildren
+	}
+
+	// $$ x $$ 写在同一行
+	if bytes.HasSuffix(rest, []byte("$$")) && len(rest) > 2 {
+		start := segment.Start + pos + 2
+		stop := segment.Start + bytes.LastIndex(line, []byte("$$"))
+		node.Lines().Append(text.NewSegment(start, stop))
+		node.singleLine = true
+		reader.AdvanceToEOL()
+		pc.Set(mathFeatureKey, true)
+		return node, parser.NoChildren
+	}
+	return nil, parser.NoChildren
+}
+
+func (p *mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*MathBlock).singleLine {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := bytes.TrimSpace(line)
+	if bytes.Equal(trimmed, []byte("$$")) {
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		stop := segment.Start + bytes.LastIndex(line, []byte("$$"))
+		node.Lines().Append(text.NewSegment(segment.Start, stop))
+		reader.AdvanceToEOL()
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.AdvanceToEOL()
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (p *mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (p *mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+type mathInlineParser struct{}
+
+func (p *mathInlineParser) Trigger() []byte {
+	return []byte{'$'}
+}
+
+// Parse 按 Pandoc 的规则识别行内公式：开头的 $ 后不能是空白，
+// 结尾的 $ 前不能是空白且后面不能紧跟数字，避免把金额误判为公式
+func (p *mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		node := &MathInline{Literal: append([]byte(nil), line[2:2+end]...), Display: true}
+		block.Advance(end + 4)
+		pc.Set(mathFeatureKey, true)
+		return node
+	}
+
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+	for i := 2; i < len(line); i++ {
+		if line[i] != '$' {
+			continue
+		}
+		if util.IsSpace(line[i-1]) || line[i-1] == '\\' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9' {
+			continue
+		}
+		node := &MathInline{Literal: append([]byte(nil), line[1:i]...)}
+		block.Advance(i + 1)
+		pc.Set(mathFeatureKey, true)
+		return node
+	}
+	return nil
+}
+
+// ========== Mermaid 图表 ==========
+
+// KindMermaidBlock Mermaid 图表节点
+var KindMermaidBlock = ast.NewNodeKind("MermaidBlock")
+
+// MermaidBlock ```mermaid 代码块
+type MermaidBlock struct {
+	ast.BaseBlock
+}
+
+func (n *MermaidBlock) Kind() ast.NodeKind { return KindMermaidBlock }
+
+func (n *MermaidBlock) IsRaw() bool { return true }
+
+func (n *MermaidBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, nil, nil)
+}
+
+// mermaidTransformer 把语言为 mermaid 的代码块替换为 MermaidBlock，
+// 避免被当作普通代码交给代码高亮处理
+type mermaidTransformer struct{}
+
+func (t *mermaidTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var blocks []*ast.FencedCodeBlock
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if cb, ok := n.(*ast.FencedCodeBlock); ok && string(cb.Language(source)) == "mermaid" {
+			blocks = append(blocks, cb)
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, cb := range blocks {
+		node := &MermaidBlock{}
+		node.SetLines(cb.Lines())
+		cb.Parent().ReplaceChild(cb.Parent(), cb, node)
+	}
+	if len(blocks) > 0 {
+		pc.Set(mermaidFeatureKey, true)
+	}
+}
+
+// ========== 渲染 ==========
+
+// extRenderer 输出 KaTeX auto-render 和 mermaid.js 可直接识别的标记（构建时不依赖网络）
+type extRenderer struct{}
+
+func (r *extRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindMathBlock, r.renderMathBlock)
+	reg.Register(KindMathInline, r.renderMathInline)
+	reg.Register(KindMermaidBlock, r.renderMermaidBlock)
+}
+
+func (r *extRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<div class="math math-display">\[`)
+	writeLines(w, source, node)
+	w.WriteString("\\]</div>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *extRenderer) renderMathInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*MathInline)
+	if n.Display {
+		w.WriteString(`<span class="math math-display">\[`)
+		w.Write(util.EscapeHTML(n.Literal))
+		w.WriteString(`\]</span>`)
+	} else {
+		w.WriteString(`<span class="math math-inline">\(`)
+		w.Write(util.EscapeHTML(n.Literal))
+		w.WriteString(`\)</span>`)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *extRenderer) renderMermaidBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	w.WriteString(`<pre class="mermaid">`)
+	writeLines(w, source, node)
+	w.WriteString("</pre>\n")
+	return ast.WalkSkipChildren, nil
+}
+
+// writeTexts 输出节点下的纯文本（用于 alt 属性）
+func writeTexts(w util.BufWriter, source []byte, n ast.Node) {
+	for c := n.FirstChild(); c != nil; c = c.NextSibling() {
+		switch t := c.(type) {
+		case *ast.Text:
+			w.Write(util.EscapeHTML(t.Segment.Value(source)))
+		case *ast.String:
+			w.Write(util.EscapeHTML(t.Value))
+		default:
+			writeTexts(w, source, c)
+		}
+	}
+}
+
+func writeLines(w util.BufWriter, source []byte, node ast.Node) {
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		seg := lines.At(i)
+		w.Write(util.EscapeHTML(seg.Value(source)))
+	}
+}
+
+// diagramExtension 数学公式和 Mermaid 图表扩展
+type diagramExtension struct{}
+
+func (e *diagramExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(&mathBlockParser{}, 850)),
+		parser.WithInlineParsers(util.Prioritized(&mathInlineParser{}, 150)),
+		parser.WithASTTransformers(util.Prioritized(&mermaidTransformer{}, 100)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&extRenderer{}, 500),
+	))
+}
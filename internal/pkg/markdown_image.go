@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/util"
+)
+
+// imageExtension 接管图片渲染：上传图片输出 srcset、宽高，所有图片加懒加载
+type imageExtension struct {
+	// lookup 查询图片尺寸和缩放版本，为空时使用 GetImageInfo
+	lookup func(src string) *ImageInfo
+}
+
+func (e *imageExtension) Extend(m goldmark.Markdown) {
+	lookup := e.lookup
+	if lookup == nil {
+		lookup = GetImageInfo
+	}
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&imageRenderer{lookup: lookup}, 500),
+	))
+}
+
+type imageRenderer struct {
+	lookup func(src string) *ImageInfo
+}
+
+func (r *imageRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(ast.KindImage, r.renderImage)
+}
+
+// renderImage 为上传图片输出 srcset、宽高和懒加载属性，其余图片只加懒加载；节点上的其他属性原样保留
+func (r *imageRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*ast.Image)
+	dest := string(n.Destination)
+
+	w.WriteString(`<img src="`)
+	w.Write(util.EscapeHTML(util.URLEscape(n.Destination, true)))
+	w.WriteString(`" alt="`)
+	writeTexts(w, source, n)
+	w.WriteByte('"')
+	if n.Title != nil {
+		w.WriteString(` title="`)
+		w.Write(util.EscapeHTML(n.Title))
+		w.WriteByte('"')
+	}
+
+	if info := r.lookup(dest); info != nil {
+		if _, ok := n.Attribute([]byte("width")); !ok {
+			fmt.Fprintf(w, ` width="%d" height="%d"`, info.Width, info.Height)
+		}
+		if srcset := info.Srcset(dest); srcset != "" {
+			sizes := AppConfig.Images.Sizes
+			if sizes == "" {
+				sizes = "(max-width: 800px) 100vw, 800px"
+			}
+			w.WriteString(` srcset="`)
+			w.Write(util.EscapeHTML([]byte(srcset)))
+			w.WriteString(`" sizes="`)
+			w.Write(util.EscapeHTML([]byte(sizes)))
+			w.WriteByte('"')
+		}
+	}
+	if n.Attributes() != nil {
+		html.RenderAttributes(w, n, html.ImageAttributeFilter)
+	}
+	if _, ok := n.Attribute([]byte("loading")); !ok {
+		w.WriteString(` loading="lazy"`)
+	}
+	if _, ok := n.Attribute([]byte("decoding")); !ok {
+		w.WriteString(` decoding="async"`)
+	}
+	w.WriteByte('>')
+	return ast.WalkSkipChildren, nil
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// imageClassTransformer 给所有图片加上 class 属性，检查渲染时保留节点属性
+type imageClassTransformer struct{}
+
+func (imageClassTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if img, ok := n.(*ast.Image); ok && entering {
+			img.SetAttributeString("class", []byte("wide"))
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+func TestImageExtension(t *testing.T) {
+	lookup := func(src string) *ImageInfo {
+		if src != "/uploads/a.jpg" {
+			return nil
+		}
+		return &ImageInfo{Width: 1200, Height: 800, Variants: []ImageVariant{{Width: 480, URL: "/resized/uploads/a.jpg-480w.jpg"}}}
+	}
+	md := goldmark.New(
+		goldmark.WithExtensions(&imageExtension{lookup: lookup}),
+		goldmark.WithParserOptions(parser.WithASTTransformers(util.Prioritized(imageClassTransformer{}, 100))),
+	)
+
+	tests := []struct {
+		name, input string
+		want        []string
+	}{
+		{"upload", `![A & B](/uploads/a.jpg "标题")`, []string{
+			`<img src="/uploads/a.jpg" alt="A &amp; B" title="标题" width="1200" height="800"`,
+			`srcset="/resized/uploads/a.jpg-480w.jpg 480w, /uploads/a.jpg 1200w"`,
+			`class="wide"`, `loading="lazy" decoding="async">`,
+		}},
+		{"external", `![x](https://example.com/x.png)`, []string{
+			`<img src="https://example.com/x.png" alt="x" class="wide" loading="lazy" decoding="async">`,
+		}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		if err := md.Convert([]byte(tt.input), &buf); err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(buf.String(), want) {
+				t.Errorf("%s: output %q missing %q", tt.name, buf.String(), want)
+			}
+		}
+	}
+}
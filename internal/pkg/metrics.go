@@ -0,0 +1,270 @@
+package pkg
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 简单的 Prometheus 文本格式指标，只实现用到的计数器、直方图和采集时计算的仪表
+
+// 默认直方图分桶（秒），与 Prometheus 客户端库一致
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var (
+	metricsRegistry []metric
+	processStart    = time.Now()
+)
+
+func register[M metric](m M) M {
+	metricsRegistry = append(metricsRegistry, m)
+	return m
+}
+
+// counterVec 带标签的计数器
+type counterVec struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[string]float64 // 标签值以 \xff 连接作为 key
+}
+
+func newCounter(name, help string, labels ...string) *counterVec {
+	return register(&counterVec{name: name, help: help, labels: labels, values: make(map[string]float64)})
+}
+
+func (c *counterVec) Inc(labelValues ...string) {
+	c.mu.Lock()
+	c.values[strings.Join(labelValues, "\xff")]++
+	c.mu.Unlock()
+}
+
+func (c *counterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+	if len(c.labels) == 0 && len(c.values) == 0 {
+		fmt.Fprintf(w, "%s 0\n", c.name)
+	}
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, formatLabels(c.labels, splitKey(key), "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// histogramVec 带标签的直方图
+type histogramVec struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	series map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	counts []uint64 // 每个分桶（不累计）的观测数，最后一个为 +Inf
+	sum    float64
+	count  uint64
+}
+
+func newHistogram(name, help string, labels ...string) *histogramVec {
+	return register(&histogramVec{name: name, help: help, labels: labels, buckets: defaultBuckets, series: make(map[string]*histogramSeries)})
+}
+
+func (h *histogramVec) Observe(d time.Duration, labelValues ...string) {
+	v := d.Seconds()
+	key := strings.Join(labelValues, "\xff")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s := h.series[key]
+	if s == nil {
+		s = &histogramSeries{counts: make([]uint64, len(h.buckets)+1)}
+		h.series[key] = s
+	}
+	s.counts[sort.SearchFloat64s(h.buckets, v)]++
+	s.sum += v
+	s.count++
+}
+
+func (h *histogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		values := splitKey(key)
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", formatFloat(upper)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, formatLabels(h.labels, values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, formatLabels(h.labels, values, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, formatLabels(h.labels, values, "", ""), s.count)
+	}
+}
+
+// gaugeFunc 采集时计算的仪表，fn 返回 标签值 -> 数值，无标签时用空字符串作 key
+type gaugeFunc struct {
+	name, help string
+	label      string
+	fn         func() map[string]float64
+}
+
+func newGaugeFunc(name, help, label string, fn func() map[string]float64) *gaugeFunc {
+	return register(&gaugeFunc{name: name, help: help, label: label, fn: fn})
+}
+
+func (g *gaugeFunc) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n", g.name, g.help, g.name)
+	values := g.fn()
+	for _, key := range sortedKeys(values) {
+		labels := ""
+		if g.label != "" {
+			labels = formatLabels([]string{g.label}, []string{key}, "", "")
+		}
+		fmt.Fprintf(w, "%s%s %s\n", g.name, labels, formatFloat(values[key]))
+	}
+}
+
+func sortedKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func splitKey(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, "\xff")
+}
+
+func formatLabels(names, values []string, extraName, extraValue string) string {
+	var parts []string
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		parts = append(parts, name+`="`+escapeLabelValue(value)+`"`)
+	}
+	if extraName != "" {
+		parts = append(parts, extraName+`="`+extraValue+`"`)
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// ========== 指标定义 ==========
+
+var (
+	httpRequests = newCounter("mdblog_http_requests_total",
+		"HTTP requests by method, route template and status code.", "method", "route", "status")
+	httpDuration = newHistogram("mdblog_http_request_duration_seconds",
+		"HTTP request latency by method and route template.", "method", "route")
+	templateDuration = newHistogram("mdblog_template_render_duration_seconds",
+		"Theme template render time.", "template")
+	markdownCache = newCounter("mdblog_markdown_cache_requests_total",
+		"Rendered Markdown cache lookups in GetCachedContent.", "result")
+	searchDuration = newHistogram("mdblog_search_duration_seconds",
+		"Full-text search query latency.")
+	commentSubmissions = newCounter("mdblog_comment_submissions_total",
+		"Accepted comment submissions by resulting state.", "state")
+	pageCacheRequests = newCounter("mdblog_page_cache_requests_total",
+		"Full-page cache lookups.", "result")
+	contentReloadDuration = newHistogram("mdblog_content_reload_duration_seconds",
+		"Time to reload all posts from the content directory.")
+
+	_ = newGaugeFunc("mdblog_posts", "Loaded posts by state.", "state", func() map[string]float64 {
+		published, drafts := PostCounts()
+		return map[string]float64{
+			"published": float64(published),
+			"draft":     float64(drafts),
+		}
+	})
+	_ = newGaugeFunc("mdblog_goroutines", "Number of goroutines.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(runtime.NumGoroutine())}
+	})
+	_ = newGaugeFunc("process_start_time_seconds", "Start time of the process since unix epoch in seconds.", "", func() map[string]float64 {
+		return map[string]float64{"": float64(processStart.Unix())}
+	})
+)
+
+// ObserveHTTPRequest 记录一次 HTTP 请求，route 为路由模板（如 /admin/edit），未匹配路由时由调用方传入固定值
+func ObserveHTTPRequest(method, route string, status int, d time.Duration) {
+	method = metricMethod(method)
+	httpRequests.Inc(method, route, strconv.Itoa(status))
+	httpDuration.Observe(d, method, route)
+}
+
+// metricMethod 标准方法原样记录，其余归为 other，避免客户端随意构造方法名刷出大量序列
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// ObserveTemplateRender 记录主题模板渲染耗时
+func ObserveTemplateRender(name string, d time.Duration) {
+	templateDuration.Observe(d, name)
+}
+
+func commentState(c Comment) string {
+	switch {
+	case c.Spam:
+		return "spam"
+	case c.Approved:
+		return "approved"
+	default:
+		return "pending"
+	}
+}
+
+// WriteMetrics 以 Prometheus 文本格式输出全部指标
+func WriteMetrics(w io.Writer) {
+	for _, m := range metricsRegistry {
+		m.write(w)
+	}
+}
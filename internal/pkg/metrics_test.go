@@ -0,0 +1,32 @@
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestObserveHTTPRequestMethodLabel(t *testing.T) {
+	// 指标是全局的，每次运行用不同的路由标签，多次运行（-count）互不影响
+	route := fmt.Sprintf("/test-%d", time.Now().UnixNano())
+	for _, method := range []string{"FOO1", "FOO2", "get", "PROPFIND"} {
+		ObserveHTTPRequest(method, route, 404, time.Millisecond)
+	}
+	ObserveHTTPRequest("GET", route, 404, time.Millisecond)
+
+	var out strings.Builder
+	WriteMetrics(&out)
+	metrics := out.String()
+	for _, bad := range []string{"FOO1", "FOO2", `method="get"`, "PROPFIND"} {
+		if strings.Contains(metrics, bad) {
+			t.Errorf("metrics contain client-supplied method %q", bad)
+		}
+	}
+	if !strings.Contains(metrics, `mdblog_http_requests_total{method="other",route="`+route+`",status="404"} 4`) {
+		t.Errorf("non-standard methods not counted as other:\n%s", metrics)
+	}
+	if !strings.Contains(metrics, `method="GET",route="`+route+`"`) {
+		t.Error("standard method missing")
+	}
+}
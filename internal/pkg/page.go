@@ -14,7 +14,8 @@ type Page struct {
 	Date     time.Time
 	Content  string
 	FilePath string
-	Hidden   bool // 是否在导航栏隐藏
+	Hidden   bool      // 是否在导航栏隐藏
+	ModTime  time.Time // 文件修改时间
 }
 
 func ListPages() ([]Page, error) {
@@ -48,6 +49,7 @@ func ListPages() ([]Page, error) {
 				Date:     post.Date,
 				FilePath: filePath,
 				Hidden:   hidden,
+				ModTime:  post.ModTime,
 			})
 		}
 	}
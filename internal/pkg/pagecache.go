@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"bytes"
+	"container/list"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 前台整页缓存：按 主题 + 路径 + 查询参数 缓存渲染后的 HTML，
+// 文章重新载入、评论或 Webmention 保存、后台任何修改操作都会清空缓存。
+// 导航数据（分类、独立页面）也在这里缓存，页面访问不再扫描目录
+
+// maxCachedPages 最多缓存的页面数，超过后淘汰最久未访问的页面
+const maxCachedPages = 1000
+
+// CommentTokenPlaceholder 渲染时代替评论表单令牌，输出前替换为新令牌，避免缓存的页面带着旧令牌
+const CommentTokenPlaceholder = "\x00comment-token\x00"
+
+type cachedPage struct {
+	key      string
+	body     []byte
+	storedAt time.Time
+}
+
+var (
+	pageCacheLock sync.Mutex
+	pageCache     = make(map[string]*list.Element) // 元素值为 *cachedPage
+	pageLRU       = list.New()                     // 最近访问的在前
+	pageCacheGen  uint64                           // 每次失效加一，渲染开始后发生过失效的结果不写入缓存
+	siteChangedAt time.Time                        // 最近一次失效的时间，即评论、设置等可能影响页面的变化
+
+	navLock       sync.Mutex
+	navLoaded     bool
+	navCategories []CategoryInfo
+	navPages      []Page // 全部独立页面，含导航栏隐藏的
+)
+
+// PageCacheEnabled 是否开启整页缓存
+func PageCacheEnabled() bool {
+	return AppConfig.Cache.Pages
+}
+
+// PageCacheGeneration 当前缓存代数，写入缓存时需传回
+func PageCacheGeneration() uint64 {
+	pageCacheLock.Lock()
+	defer pageCacheLock.Unlock()
+	return pageCacheGen
+}
+
+// GetCachedPage 读取缓存的页面，超过 cache.ttl 的视为未命中
+func GetCachedPage(key string) ([]byte, bool) {
+	pageCacheLock.Lock()
+	var page *cachedPage
+	if elem, ok := pageCache[key]; ok {
+		page = elem.Value.(*cachedPage)
+		if AppConfig.Cache.TTL > 0 && time.Since(page.storedAt) > time.Duration(AppConfig.Cache.TTL)*time.Second {
+			page = nil
+		} else {
+			pageLRU.MoveToFront(elem)
+		}
+	}
+	pageCacheLock.Unlock()
+
+	if page == nil {
+		pageCacheRequests.Inc("miss")
+		return nil, false
+	}
+	pageCacheRequests.Inc("hit")
+	return page.body, true
+}
+
+// StoreCachedPage 写入缓存，gen 为开始渲染前取得的缓存代数。缓存已满时淘汰最久未访问的页面
+func StoreCachedPage(key string, gen uint64, body []byte) {
+	pageCacheLock.Lock()
+	defer pageCacheLock.Unlock()
+	if gen != pageCacheGen {
+		return
+	}
+	page := &cachedPage{key: key, body: body, storedAt: time.Now()}
+	if elem, ok := pageCache[key]; ok {
+		elem.Value = page
+		pageLRU.MoveToFront(elem)
+		return
+	}
+	pageCache[key] = pageLRU.PushFront(page)
+	for len(pageCache) > maxCachedPages {
+		oldest := pageLRU.Back()
+		pageLRU.Remove(oldest)
+		delete(pageCache, oldest.Value.(*cachedPage).key)
+	}
+}
+
+// InvalidatePageCache 清空整页缓存和导航数据
+func InvalidatePageCache() {
+	pageCacheLock.Lock()
+	pageCache = make(map[string]*list.Element)
+	pageLRU.Init()
+	pageCacheGen++
+	siteChangedAt = time.Now()
+	pageCacheLock.Unlock()
+
+	navLock.Lock()
+	navLoaded = false
+	navCategories, navPages = nil, nil
+	navLock.Unlock()
+}
+
+// ContentLastModified 文章和独立页面文件的最近修改时间
+func ContentLastModified() time.Time {
+	var latest time.Time
+	for _, post := range currentSnapshot().byKey {
+		if post.ModTime.After(latest) {
+			latest = post.ModTime
+		}
+	}
+
+	for _, page := range CachedPages() {
+		if page.ModTime.After(latest) {
+			latest = page.ModTime
+		}
+	}
+	return latest
+}
+
+// SiteLastModified 渲染页面的最近修改时间：内容文件的修改时间和最近一次评论、设置等变化中较晚的
+func SiteLastModified() time.Time {
+	latest := ContentLastModified()
+	pageCacheLock.Lock()
+	defer pageCacheLock.Unlock()
+	if siteChangedAt.After(latest) {
+		latest = siteChangedAt
+	}
+	return latest
+}
+
+// FillPageTokens 把页面中的占位符替换为本次请求的值
+func FillPageTokens(body []byte) []byte {
+	if !bytes.Contains(body, []byte(CommentTokenPlaceholder)) {
+		return body
+	}
+	return bytes.ReplaceAll(body, []byte(CommentTokenPlaceholder), []byte(NewCommentFormToken()))
+}
+
+func loadNav() {
+	if navLoaded {
+		return
+	}
+	cats, err := ListCategories()
+	if err != nil {
+		return
+	}
+	sort.Slice(cats, func(i, j int) bool {
+		return cats[i].Name < cats[j].Name
+	})
+	pages, err := ListPages()
+	if err != nil {
+		return
+	}
+	navCategories, navPages, navLoaded = cats, pages, true
+}
+
+// CachedCategories 按名称排序的分类列表（缓存）
+func CachedCategories() []CategoryInfo {
+	navLock.Lock()
+	defer navLock.Unlock()
+	loadNav()
+	return append([]CategoryInfo(nil), navCategories...)
+}
+
+// CachedPages 全部独立页面（缓存）
+func CachedPages() []Page {
+	navLock.Lock()
+	defer navLock.Unlock()
+	loadNav()
+	return append([]Page(nil), navPages...)
+}
+
+// CachedVisiblePages 导航栏显示的独立页面（缓存）
+func CachedVisiblePages() []Page {
+	var visible []Page
+	for _, p := range CachedPages() {
+		if !p.Hidden {
+			visible = append(visible, p)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPageCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	setupTestDir(t)
+	InvalidatePageCache()
+	gen := PageCacheGeneration()
+
+	StoreCachedPage("/", gen, []byte("home"))
+	for i := 0; i < maxCachedPages-1; i++ {
+		StoreCachedPage(fmt.Sprintf("/junk?%d", i), gen, []byte("junk"))
+	}
+	// 访问首页使其变为最近使用，之后新写入的页面应淘汰最旧的 junk 而不是首页或被拒绝
+	if _, ok := GetCachedPage("/"); !ok {
+		t.Fatal("home page missing before the cache is full")
+	}
+	StoreCachedPage("/tech/post.html", gen, []byte("post"))
+
+	if _, ok := GetCachedPage("/tech/post.html"); !ok {
+		t.Error("new page was not cached once the cache was full")
+	}
+	if _, ok := GetCachedPage("/"); !ok {
+		t.Error("recently used page was evicted")
+	}
+	if _, ok := GetCachedPage("/junk?0"); ok {
+		t.Error("least recently used page was not evicted")
+	}
+	if len(pageCache) != maxCachedPages || pageLRU.Len() != maxCachedPages {
+		t.Errorf("cache holds %d/%d entries, want %d", len(pageCache), pageLRU.Len(), maxCachedPages)
+	}
+}
+
+func TestPageCacheDropsStaleGeneration(t *testing.T) {
+	setupTestDir(t)
+	gen := PageCacheGeneration()
+	InvalidatePageCache()
+
+	StoreCachedPage("/", gen, []byte("rendered before invalidation"))
+	if _, ok := GetCachedPage("/"); ok {
+		t.Error("page rendered before invalidation was cached")
+	}
+}
@@ -0,0 +1,247 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+)
+
+// legacyPostID 没有 front matter id 的文章暂用 category/slug 作为 ID。服务启动时、后台保存文章
+// 或执行 mdblog ids 时写入 ULID，并把已有的评论、统计迁移过去；只有文件不可写时才会一直沿用
+func legacyPostID(post *Post) string {
+	return strings.ToLower(post.Category + "/" + post.Slug)
+}
+
+// EnsurePostID 后台保存或移动文章前后调用：文件没有 front matter id 时写入一个。
+// 原来有 ID 的（编辑时删掉了 id 行）写回原 ID；原来暂用 category/slug 的生成 ULID，
+// 并把按旧 ID 记录的评论、访问统计和 Webmention 迁移到新 ID
+func EnsurePostID(path string) error {
+	parsed, err := ParseMarkdownFile(path)
+	if err != nil {
+		return err
+	}
+	if parsed.ID != "" {
+		return nil
+	}
+	old := GetPostByFilePath(path)
+	if old != nil && !old.legacyID {
+		return writeFrontMatterID(path, old.ID)
+	}
+	id := NewULID()
+	if err := writeFrontMatterID(path, id); err != nil {
+		return err
+	}
+	oldID := legacyPostID(parsed)
+	if old != nil {
+		oldID = old.ID
+	}
+	rekeyPost(oldID, id)
+	slog.Info("assigned post id", "id", id, "path", path, "previous", oldID)
+	return nil
+}
+
+// AssignPostIDs 为所有没有 front matter id 的文章写入 ULID（mdblog ids），返回处理的文章数。
+// 需在文章、评论、统计和 Webmention 都载入后调用
+func AssignPostIDs() (int, error) {
+	var paths []string
+	for path, post := range currentSnapshot().byPath {
+		if post.legacyID {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	assigned := 0
+	var err error
+	for _, path := range paths {
+		if e := EnsurePostID(path); e != nil {
+			err = fmt.Errorf("%s: %w", path, e)
+			break
+		}
+		assigned++
+	}
+	// 出错前已写入的 ID 同样需要重新载入
+	if assigned > 0 {
+		LoadAllPosts()
+	}
+	return assigned, err
+}
+
+// rekeyPost 把按 oldID 记录的评论、访问统计和 Webmention 改为 newID
+func rekeyPost(oldID, newID string) {
+	commentsLock.Lock()
+	changed := false
+	for i := range comments {
+		if comments[i].PostID == oldID {
+			comments[i].PostID = newID
+			changed = true
+		}
+	}
+	if changed {
+		if err := saveComments(); err != nil {
+			slog.Error("failed to save comments", "err", err)
+		}
+	}
+	commentsLock.Unlock()
+
+	statsLock.Lock()
+	changed = rekeyCount(stats.TopPosts, oldID, newID)
+	for _, counts := range stats.DailyPosts {
+		changed = rekeyCount(counts, oldID, newID) || changed
+	}
+	for _, counts := range stats.MonthlyPosts {
+		changed = rekeyCount(counts, oldID, newID) || changed
+	}
+	if changed {
+		if err := saveStats(); err != nil {
+			slog.Error("failed to save stats", "err", err)
+		}
+	}
+	statsLock.Unlock()
+
+	webmentionsLock.Lock()
+	changed = false
+	for i := range webmentions {
+		if webmentions[i].PostID == oldID {
+			webmentions[i].PostID = newID
+			changed = true
+		}
+	}
+	if changed {
+		if err := saveWebmentions(); err != nil {
+			slog.Error("failed to save webmentions", "err", err)
+		}
+	}
+	webmentionsLock.Unlock()
+
+	sentWebmentionsLock.Lock()
+	if links, ok := sentWebmentions[oldID]; ok {
+		sentWebmentions[newID] = links
+		delete(sentWebmentions, oldID)
+		if err := saveSentWebmentions(); err != nil {
+			slog.Error("failed to save sent webmentions", "err", err)
+		}
+	}
+	sentWebmentionsLock.Unlock()
+}
+
+func rekeyCount(counts map[string]int, oldID, newID string) bool {
+	n, ok := counts[oldID]
+	if !ok {
+		return false
+	}
+	counts[newID] += n
+	delete(counts, oldID)
+	return true
+}
+
+// writeFrontMatterID 在 front matter 开头插入 id 字段，没有 front matter 时新建
+func writeFrontMatterID(path, id string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	line := []byte("id: " + id + "\n")
+	var out []byte
+	switch {
+	case bytes.HasPrefix(content, []byte("---\r\n")):
+		out = append([]byte("---\r\nid: "+id+"\r\n"), content[5:]...)
+	case bytes.HasPrefix(content, []byte("---\n")):
+		out = append(append([]byte("---\n"), line...), content[4:]...)
+	default:
+		out = append(append(append([]byte("---\n"), line...), []byte("---\n\n")...), content...)
+	}
+	return os.WriteFile(path, out, info.Mode().Perm())
+}
+
+// postIDForSlug 旧数据只记录了 slug，按 slug 找到对应文章的 ID；
+// 多个分类有同名 slug 时按 category/slug 排序取第一个
+func postIDForSlug(slug string) string {
+	posts := currentSnapshot().byKey
+	var keys []string
+	for key, post := range posts {
+		if post.Slug == slug {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return ""
+	}
+	sort.Strings(keys)
+	if len(keys) > 1 {
+		slog.Warn("migration: ambiguous slug", "slug", slug, "using", keys[0], "candidates", strings.Join(keys, ", "))
+	}
+	return posts[keys[0]].ID
+}
+
+// MigratePostIdentity 一次性迁移：旧版评论和访问统计按 slug 记录，改为按文章 ID 记录。
+// 需在文章、评论和统计都载入后调用；已迁移的数据不会重复处理
+func MigratePostIdentity() {
+	migrateComments()
+	migrateStats()
+}
+
+func migrateComments() {
+	commentsLock.Lock()
+	defer commentsLock.Unlock()
+
+	migrated, orphaned := 0, 0
+	cache := make(map[string]string)
+	for i := range comments {
+		if comments[i].PostID != "" {
+			continue
+		}
+		slug := comments[i].PostSlug
+		id, ok := cache[slug]
+		if !ok {
+			id = postIDForSlug(slug)
+			cache[slug] = id
+		}
+		if id == "" {
+			orphaned++
+			continue
+		}
+		comments[i].PostID = id
+		migrated++
+	}
+	if migrated == 0 {
+		return
+	}
+	if err := saveComments(); err != nil {
+		slog.Error("migration: failed to save comments", "err", err)
+		return
+	}
+	slog.Info("migration: comments now keyed by post id", "migrated", migrated, "orphaned", orphaned)
+}
+
+func migrateStats() {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	if stats.Version >= statsVersion {
+		return
+	}
+	topPosts := make(map[string]int, len(stats.TopPosts))
+	for slug, views := range stats.TopPosts {
+		key := slug
+		if id := postIDForSlug(slug); id != "" {
+			key = id
+		}
+		topPosts[key] += views
+	}
+	stats.TopPosts = topPosts
+	stats.Version = statsVersion
+	if err := saveStats(); err != nil {
+		slog.Error("migration: failed to save stats", "err", err)
+		return
+	}
+	slog.Info("migration: view stats now keyed by post id")
+}
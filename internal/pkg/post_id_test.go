@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAssignPostIDs(t *testing.T) {
+	setupStats(t)
+	legacy := writeTestPost(t, "tech", "hello", "title: Hello\ndate: 2024-01-01", "legacy")
+	kept := writeTestPost(t, "tech", "kept", "id: 01KEPT\ntitle: Kept\ndate: 2024-01-02", "kept")
+	loadTestPosts(t)
+
+	if post := GetPostByFilePath(legacy); post == nil || post.ID != "tech/hello" {
+		t.Fatalf("legacy post not loaded with category/slug id: %+v", post)
+	}
+	setTestComments(t, []Comment{{ID: "c1", PostID: "tech/hello", Approved: true}})
+	statsLock.Lock()
+	stats.TopPosts["tech/hello"] = 3
+	statsLock.Unlock()
+
+	n, err := AssignPostIDs()
+	if err != nil || n != 1 {
+		t.Fatalf("AssignPostIDs() = %d, %v, want 1, nil", n, err)
+	}
+
+	post := GetPostByFilePath(legacy)
+	if post == nil || len(post.ID) != 26 {
+		t.Fatalf("legacy post did not get a ULID: %+v", post)
+	}
+	data, _ := os.ReadFile(legacy)
+	if !strings.HasPrefix(string(data), "---\nid: "+post.ID+"\n") {
+		t.Errorf("id not written to front matter:\n%s", data)
+	}
+	if got := GetCommentsByPost(post.ID); len(got) != 1 {
+		t.Errorf("comments not rekeyed: %d comments under new id", len(got))
+	}
+	statsLock.RLock()
+	views, old := stats.TopPosts[post.ID], stats.TopPosts["tech/hello"]
+	statsLock.RUnlock()
+	if views != 3 || old != 0 {
+		t.Errorf("stats not rekeyed: new=%d old=%d", views, old)
+	}
+	if p := GetPostByFilePath(kept); p == nil || p.ID != "01KEPT" {
+		t.Errorf("existing id changed: %+v", p)
+	}
+
+	// 再次运行不应有变化
+	if n, err := AssignPostIDs(); err != nil || n != 0 {
+		t.Errorf("second AssignPostIDs() = %d, %v, want 0, nil", n, err)
+	}
+}
+
+func TestEnsurePostIDReturnsParseError(t *testing.T) {
+	setupTestDir(t)
+	if err := EnsurePostID(filepath.Join("content", "blog", "missing.md")); err == nil {
+		t.Error("EnsurePostID on a missing file returned nil")
+	}
+}
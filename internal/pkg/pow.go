@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 评论工作量证明（Proof of Work）
+//
+// 服务端签发带签名的 challenge，浏览器需找到 nonce 使 SHA-256(challenge + nonce)
+// 的前 difficulty 位为 0。challenge 自带难度和签发时间，只能使用一次。
+
+// ErrPoWInvalid 工作量证明校验失败
+var ErrPoWInvalid = errors.New("人机验证失败，请重试")
+
+const powTTL = 10 * time.Minute
+
+var (
+	powUsedLock sync.Mutex
+	powUsed     = make(map[string]time.Time) // 已使用的 challenge -> 过期时间
+)
+
+// PoWChallenge 下发给浏览器的题目
+type PoWChallenge struct {
+	Challenge  string `json:"challenge"`
+	Difficulty int    `json:"difficulty"`
+}
+
+// PoWEnabled 是否启用评论工作量证明
+func PoWEnabled() bool {
+	return AppConfig.Comments.PoW
+}
+
+// powDifficulty 难度（前导零位数），默认 16，限制在 8~24 之间
+func powDifficulty() int {
+	d := AppConfig.Comments.PoWDifficulty
+	if d == 0 {
+		d = 16
+	}
+	if d < 8 {
+		d = 8
+	}
+	if d > 24 {
+		d = 24
+	}
+	return d
+}
+
+func signPoW(payload string) string {
+	mac := hmac.New(sha256.New, commentFormSecret())
+	mac.Write([]byte("pow:" + payload))
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// NewPoWChallenge 签发新题目，格式为 随机串.签发时间.难度.签名
+func NewPoWChallenge() PoWChallenge {
+	random := make([]byte, 12)
+	rand.Read(random)
+	difficulty := powDifficulty()
+	payload := fmt.Sprintf("%s.%d.%d", hex.EncodeToString(random), time.Now().Unix(), difficulty)
+	return PoWChallenge{
+		Challenge:  payload + "." + signPoW(payload),
+		Difficulty: difficulty,
+	}
+}
+
+// VerifyPoW 校验答案，成功后 challenge 作废
+func VerifyPoW(challenge, nonce string) error {
+	parts := strings.Split(challenge, ".")
+	if len(parts) != 4 || nonce == "" || len(nonce) > 20 {
+		return ErrPoWInvalid
+	}
+	payload := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(signPoW(payload))) {
+		return ErrPoWInvalid
+	}
+	issued, err1 := strconv.ParseInt(parts[1], 10, 64)
+	difficulty, err2 := strconv.Atoi(parts[2])
+	if err1 != nil || err2 != nil || time.Since(time.Unix(issued, 0)) > powTTL {
+		return ErrPoWInvalid
+	}
+
+	sum := sha256.Sum256([]byte(challenge + nonce))
+	if leadingZeroBits(sum[:]) < difficulty {
+		return ErrPoWInvalid
+	}
+
+	powUsedLock.Lock()
+	defer powUsedLock.Unlock()
+	now := time.Now()
+	for c, exp := range powUsed {
+		if now.After(exp) {
+			delete(powUsed, c)
+		}
+	}
+	if _, used := powUsed[challenge]; used {
+		return ErrPoWInvalid
+	}
+	powUsed[challenge] = time.Unix(issued, 0).Add(powTTL)
+	return nil
+}
+
+func leadingZeroBits(hash []byte) int {
+	n := 0
+	for _, b := range hash {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
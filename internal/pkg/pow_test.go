@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 与 themes/pure/static/pow.js 注释中的已知答案一致
+const (
+	powVectorChallenge = "0123456789abcdef01234567.1700000000.16.0123456789abcdef0123456789abcdef"
+	powVectorNonce     = "22270"
+	powVectorHash      = "0000e482fa5ec2d8cb7d4a29484e43028c76999a0b3c3c8ee850bec5152f3333"
+)
+
+// solveTestPoW 与 pow.js 相同，从 0 开始找第一个满足难度的 nonce
+func solveTestPoW(challenge string, difficulty int) string {
+	for n := 0; ; n++ {
+		nonce := strconv.Itoa(n)
+		sum := sha256.Sum256([]byte(challenge + nonce))
+		if leadingZeroBits(sum[:]) >= difficulty {
+			return nonce
+		}
+	}
+}
+
+func TestPoWKnownAnswer(t *testing.T) {
+	sum := sha256.Sum256([]byte(powVectorChallenge + powVectorNonce))
+	if got := hex.EncodeToString(sum[:]); got != powVectorHash {
+		t.Fatalf("hash = %s, want %s", got, powVectorHash)
+	}
+	if got := leadingZeroBits(sum[:]); got != 16 {
+		t.Errorf("leadingZeroBits = %d, want 16", got)
+	}
+	if got := solveTestPoW(powVectorChallenge, 16); got != powVectorNonce {
+		t.Errorf("first nonce = %s, want %s", got, powVectorNonce)
+	}
+}
+
+// TestPoWScriptKnownAnswer 用 node 跑浏览器端脚本，确认两端结果一致
+func TestPoWScriptKnownAnswer(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("node not installed")
+	}
+	out, err := exec.Command(node, "testdata/pow_vector.js").CombinedOutput()
+	if err != nil {
+		t.Fatalf("pow.js: %v\n%s", err, out)
+	}
+}
+
+func TestLeadingZeroBits(t *testing.T) {
+	tests := []struct {
+		hash []byte
+		want int
+	}{
+		{[]byte{0x80}, 0},
+		{[]byte{0x01}, 7},
+		{[]byte{0x00, 0x00, 0xff}, 16},
+		{[]byte{0x00, 0x0f}, 12},
+		{[]byte{0x00, 0x00}, 16},
+	}
+	for _, tt := range tests {
+		if got := leadingZeroBits(tt.hash); got != tt.want {
+			t.Errorf("leadingZeroBits(%x) = %d, want %d", tt.hash, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyPoW(t *testing.T) {
+	setupTestDir(t)
+	AppConfig.Comments.PoWDifficulty = 8
+
+	signed := func(issued time.Time, difficulty int) string {
+		payload := fmt.Sprintf("0123456789abcdef01234567.%d.%d", issued.Unix(), difficulty)
+		return payload + "." + signPoW(payload)
+	}
+	fresh := NewPoWChallenge().Challenge
+	expired := signed(time.Now().Add(-powTTL-time.Minute), 8)
+	tampered := strings.Replace(signed(time.Now(), 8), ".8.", ".1.", 1)
+
+	tests := []struct {
+		name      string
+		challenge string
+		nonce     string
+		want      error
+	}{
+		{"valid", fresh, solveTestPoW(fresh, 8), nil},
+		{"replay", fresh, solveTestPoW(fresh, 8), ErrPoWInvalid},
+		{"expired", expired, solveTestPoW(expired, 8), ErrPoWInvalid},
+		{"tampered difficulty", tampered, solveTestPoW(tampered, 1), ErrPoWInvalid},
+		{"unsigned", powVectorChallenge, powVectorNonce, ErrPoWInvalid},
+		{"empty nonce", signed(time.Now(), 8), "", ErrPoWInvalid},
+		{"long nonce", signed(time.Now(), 8), strings.Repeat("1", 21), ErrPoWInvalid},
+		{"malformed", "abc", "1", ErrPoWInvalid},
+	}
+	for _, tt := range tests {
+		if err := VerifyPoW(tt.challenge, tt.nonce); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// 找一个不满足难度的 nonce
+	c := signed(time.Now(), 16)
+	for n := 0; ; n++ {
+		sum := sha256.Sum256([]byte(c + strconv.Itoa(n)))
+		if leadingZeroBits(sum[:]) < 16 {
+			if err := VerifyPoW(c, strconv.Itoa(n)); err != ErrPoWInvalid {
+				t.Errorf("insufficient work: got %v, want %v", err, ErrPoWInvalid)
+			}
+			break
+		}
+	}
+}
@@ -100,6 +100,13 @@ func (g *StaticGenerator) copyStatic() error {
 		}
 	}
 
+	// 复制缩放图片缓存（文章渲染时已按需生成）
+	if _, err := os.Stat(ImageCacheDir()); err == nil {
+		if err := copyDir(ImageCacheDir(), filepath.Join(g.OutputDir, strings.Trim(ResizedURLPrefix, "/"))); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -163,14 +170,14 @@ func (g *StaticGenerator) generatePosts() error {
 		}
 
 		// 评论（静态版本为空）
-		ctx["Comments"] = []Comment{}
+		ctx["CommentPage"] = CommentPage{Page: 1, TotalPages: 1}
 
 		// 输出路径
 		outDir := filepath.Join(g.OutputDir, post.Category)
 		os.MkdirAll(outDir, 0755)
 		outPath := filepath.Join(outDir, post.Slug+".html")
 
-		if err := g.renderTemplate("post.html", ctx, outPath); err != nil {
+		if err := g.renderTemplate(ResolveLayout(post.Layout, "post.html"), ctx, outPath); err != nil {
 			return err
 		}
 	}
@@ -364,6 +371,10 @@ func (g *StaticGenerator) baseContext() pongo2.Context {
 		"Site":          AppConfig.Site,
 		"NavCategories": categories,
 		"NavPages":      pages,
+		// 静态资源原样复制，不加指纹
+		"asset": func(name string) string {
+			return "/static/" + strings.TrimPrefix(name, "/")
+		},
 	}
 }
 
@@ -2,30 +2,76 @@ package pkg
 
 import (
 	"encoding/json"
+	"log/slog"
 	"os"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
-// Stats 访问统计
+// Stats 访问统计。Daily* 按天保留 retention_days 天，之后并入按月（2006-01）汇总的 Monthly*
 type Stats struct {
-	TotalViews   int            `json:"total_views"`
-	TodayViews   int            `json:"today_views"`
-	DailyViews   map[string]int `json:"daily_views"` // 最近 7 天
-	TopPosts     map[string]int `json:"top_posts"`   // 热门文章
-	LastUpdated  string         `json:"last_updated"`
+	TotalViews       int                       `json:"total_views"`
+	TodayViews       int                       `json:"today_views"`
+	BotViews         int                       `json:"bot_views,omitempty"`         // 被识别为爬虫、未计入统计的访问
+	DailyViews       map[string]int            `json:"daily_views"`                 // 每日访问量
+	DailyVisitors    map[string]int            `json:"daily_visitors,omitempty"`    // 每日独立访客数（估算）
+	DailyPosts       map[string]map[string]int `json:"daily_posts,omitempty"`       // 日期 -> 文章 ID -> 访问量
+	DailyReferrers   map[string]map[string]int `json:"daily_referrers,omitempty"`   // 日期 -> 来源域名 -> 访问量
+	DailyUTM         map[string]map[string]int `json:"daily_utm,omitempty"`         // 日期 -> utm_source -> 访问量
+	MonthlyViews     map[string]int            `json:"monthly_views,omitempty"`     // 月份 -> 访问量
+	MonthlyVisitors  map[string]int            `json:"monthly_visitors,omitempty"`  // 月份 -> 每日独立访客数之和
+	MonthlyPosts     map[string]map[string]int `json:"monthly_posts,omitempty"`     // 月份 -> 文章 ID -> 访问量
+	MonthlyReferrers map[string]map[string]int `json:"monthly_referrers,omitempty"` // 月份 -> 来源域名 -> 访问量
+	MonthlyUTM       map[string]map[string]int `json:"monthly_utm,omitempty"`       // 月份 -> utm_source -> 访问量
+	TopPosts         map[string]int            `json:"top_posts"`                   // 热门文章（累计），Key 为文章 ID
+	LastUpdated      string                    `json:"last_updated"`
+	Version          int                       `json:"version"` // 数据格式版本，见 statsVersion
 }
 
+// PostViews 一段时间内文章的访问量
+type PostViews struct {
+	Post  *Post
+	Views int
+}
+
+// NamedCount 来源、UTM 等按名称汇总的访问量
+type NamedCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// 每天最多记录的来源域名 / utm_source 数量，超出的计入 (other)，防止被刷出大量条目
+const maxDailyKeys = 200
+
+// statsVersion 当前统计数据格式版本：1 表示 TopPosts 按文章 ID 记录
+const statsVersion = 1
+
+// statsFlushInterval 访问计数在内存中累积，按此间隔写盘，退出时再写一次
+const statsFlushInterval = 30 * time.Second
+
 var (
-	stats     Stats
-	statsLock sync.RWMutex
-	statsFile = "data/stats.json"
+	stats      Stats
+	statsLock  sync.RWMutex
+	statsFile  = "data/stats.json"
+	statsDirty bool // 内存中有尚未写盘的访问记录
+	statsOnce  sync.Once
 )
 
-// InitStats 初始化统计
+// InitStats 初始化统计，并启动定期写盘
 func InitStats() {
 	os.MkdirAll("data", 0755)
 	loadStats()
+	statsOnce.Do(func() {
+		go func() {
+			for range time.Tick(statsFlushInterval) {
+				if err := FlushStats(); err != nil {
+					slog.Error("failed to save stats", "err", err)
+				}
+			}
+		}()
+	})
 }
 
 func loadStats() {
@@ -36,6 +82,7 @@ func loadStats() {
 		DailyViews: make(map[string]int),
 		TopPosts:   make(map[string]int),
 	}
+	statsDirty = false
 
 	data, err := os.ReadFile(statsFile)
 	if err != nil {
@@ -49,27 +96,132 @@ func loadStats() {
 		stats.TodayViews = 0
 		stats.LastUpdated = today
 	}
+	compactStats()
+}
+
+// statsMinRetentionDays 后台图表和热门文章最长查询 365 天，每日明细至少保留这么久，
+// 否则超出保留期的日期在图表上会显示为 0
+const statsMinRetentionDays = 365
+
+// statsRetentionDays 每日明细保留天数，默认 400，配置小于 statsMinRetentionDays 时按后者
+func statsRetentionDays() int {
+	d := AppConfig.Stats.RetentionDays
+	if d <= 0 {
+		d = 400
+	}
+	if d < statsMinRetentionDays {
+		d = statsMinRetentionDays
+	}
+	return d
+}
+
+// compactStats 把超过保留期的每日数据并入按月汇总，调用方需持有 statsLock 写锁。
+// 不设按周汇总：每日明细已覆盖后台所有查询范围（最长 365 天），更早的数据只用于按月导出，
+// 周又会跨月、跨年，无法与按月汇总对齐
+func compactStats() {
+	cutoff := time.Now().AddDate(0, 0, -statsRetentionDays()).Format("2006-01-02")
+	compactCounts(&stats.DailyViews, &stats.MonthlyViews, cutoff)
+	compactCounts(&stats.DailyVisitors, &stats.MonthlyVisitors, cutoff)
+	compactNested(stats.DailyPosts, &stats.MonthlyPosts, cutoff)
+	compactNested(stats.DailyReferrers, &stats.MonthlyReferrers, cutoff)
+	compactNested(stats.DailyUTM, &stats.MonthlyUTM, cutoff)
+}
+
+func compactCounts(daily, monthly *map[string]int, cutoff string) {
+	for date, n := range *daily {
+		if date >= cutoff {
+			continue
+		}
+		if *monthly == nil {
+			*monthly = make(map[string]int)
+		}
+		(*monthly)[date[:7]] += n
+		delete(*daily, date)
+		statsDirty = true
+	}
 }
 
+func compactNested(daily map[string]map[string]int, monthly *map[string]map[string]int, cutoff string) {
+	for date, counts := range daily {
+		if date >= cutoff {
+			continue
+		}
+		for key, n := range counts {
+			incNested(monthly, date[:7], key, n)
+		}
+		delete(daily, date)
+		statsDirty = true
+	}
+}
+
+// incNested 给 m[outer][inner] 加 n，按需创建各层 map
+func incNested(m *map[string]map[string]int, outer, inner string, n int) {
+	if *m == nil {
+		*m = make(map[string]map[string]int)
+	}
+	if (*m)[outer] == nil {
+		(*m)[outer] = make(map[string]int)
+	}
+	(*m)[outer][inner] += n
+}
+
+// sumNestedSince 汇总 from（2006-01-02）当天及之后的每日明细
+func sumNestedSince(daily map[string]map[string]int, from string) map[string]int {
+	totals := make(map[string]int)
+	for date, counts := range daily {
+		if date < from {
+			continue
+		}
+		for key, n := range counts {
+			totals[key] += n
+		}
+	}
+	return totals
+}
+
+// saveStats 写盘，调用方需持有 statsLock 写锁
 func saveStats() error {
 	data, err := json.MarshalIndent(stats, "", "  ")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(statsFile, data, 0644)
+	if err := writeFileAtomic(statsFile, data, 0644); err != nil {
+		return err
+	}
+	statsDirty = false
+	return nil
+}
+
+// FlushStats 把内存中尚未写盘的访问记录写入文件，退出前需调用
+func FlushStats() error {
+	statsLock.Lock()
+	defer statsLock.Unlock()
+
+	if !statsDirty {
+		return nil
+	}
+	return saveStats()
 }
 
-// RecordView 记录访问
-func RecordView(postSlug string) {
+// RecordView 记录一次访问，postID 为空表示非文章页。爬虫只计入 BotViews。
+// 只更新内存，由 FlushStats 定期写盘
+func RecordView(postID string, v Visit) {
 	statsLock.Lock()
 	defer statsLock.Unlock()
 
+	statsDirty = true
+	if IsBot(v.UserAgent) {
+		stats.BotViews++
+		return
+	}
+
 	today := time.Now().Format("2006-01-02")
 
-	// 更新日期
+	// 更新日期，跨天时顺带汇总过期数据
 	if stats.LastUpdated != today {
 		stats.TodayViews = 0
 		stats.LastUpdated = today
+		compactStats()
 	}
 
 	stats.TotalViews++
@@ -81,23 +233,41 @@ func RecordView(postSlug string) {
 	}
 	stats.DailyViews[today]++
 
-	// 清理超过 7 天的数据
-	cutoff := time.Now().AddDate(0, 0, -7).Format("2006-01-02")
-	for date := range stats.DailyViews {
-		if date < cutoff {
-			delete(stats.DailyViews, date)
+	if isNewVisitor(today, v) {
+		if stats.DailyVisitors == nil {
+			stats.DailyVisitors = make(map[string]int)
 		}
+		stats.DailyVisitors[today]++
+	}
+
+	if domain := referrerDomain(v.Referrer, v.Host); domain != "" {
+		incDailyKey(&stats.DailyReferrers, today, domain)
+	}
+	if source := strings.ToLower(strings.TrimSpace(v.UTMSource)); source != "" {
+		if len(source) > 64 {
+			source = source[:64]
+		}
+		incDailyKey(&stats.DailyUTM, today, source)
 	}
 
 	// 记录文章访问
-	if postSlug != "" {
+	if postID != "" {
 		if stats.TopPosts == nil {
 			stats.TopPosts = make(map[string]int)
 		}
-		stats.TopPosts[postSlug]++
+		stats.TopPosts[postID]++
+		incNested(&stats.DailyPosts, today, postID, 1)
 	}
+}
 
-	saveStats()
+// incDailyKey 记录来源等外部传入的键，当天条目过多时计入 (other)
+func incDailyKey(m *map[string]map[string]int, today, key string) {
+	if counts := (*m)[today]; counts != nil {
+		if _, ok := counts[key]; !ok && len(counts) >= maxDailyKeys {
+			key = "(other)"
+		}
+	}
+	incNested(m, today, key, 1)
 }
 
 // GetStats 获取统计数据
@@ -107,21 +277,83 @@ func GetStats() Stats {
 	return stats
 }
 
-// GetDailyViewsChart 获取最近 7 天的访问数据（用于图表）
-func GetDailyViewsChart() ([]string, []int) {
+// GetDailyViewsChart 获取最近 days 天（含今天）的每日访问量和独立访客数（用于图表）
+func GetDailyViewsChart(days int) (labels []string, views, visitors []int) {
 	statsLock.RLock()
 	defer statsLock.RUnlock()
 
-	var labels []string
-	var values []int
+	now := time.Now()
+	for i := days - 1; i >= 0; i-- {
+		day := now.AddDate(0, 0, -i)
+		date := day.Format("2006-01-02")
+		labels = append(labels, day.Format("01-02"))
+		views = append(views, stats.DailyViews[date])
+		visitors = append(visitors, stats.DailyVisitors[date])
+	}
+	return labels, views, visitors
+}
 
-	for i := 6; i >= 0; i-- {
-		date := time.Now().AddDate(0, 0, -i).Format("2006-01-02")
-		labels = append(labels, time.Now().AddDate(0, 0, -i).Format("01-02"))
-		values = append(values, stats.DailyViews[date])
+// GetTodayVisitors 今日独立访客数
+func GetTodayVisitors() int {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	return stats.DailyVisitors[time.Now().Format("2006-01-02")]
+}
+
+// GetTopPostsSince 统计 since 当天及之后访问量最高的文章，已删除的文章不计入。
+// 只统计保留期内的每日明细
+func GetTopPostsSince(since time.Time, limit int) []PostViews {
+	statsLock.RLock()
+	totals := sumNestedSince(stats.DailyPosts, since.Format("2006-01-02"))
+	statsLock.RUnlock()
+
+	var result []PostViews
+	for postID, views := range totals {
+		if post := GetPostByID(postID); post != nil {
+			result = append(result, PostViews{Post: post, Views: views})
+		}
 	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Views != result[j].Views {
+			return result[i].Views > result[j].Views
+		}
+		return result[i].Post.Date.After(result[j].Post.Date)
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
+}
+
+// GetTopReferrersSince 统计 since 当天及之后的主要来源域名
+func GetTopReferrersSince(since time.Time, limit int) []NamedCount {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	return topNamedCounts(sumNestedSince(stats.DailyReferrers, since.Format("2006-01-02")), limit)
+}
 
-	return labels, values
+// GetTopUTMSourcesSince 统计 since 当天及之后的主要 utm_source
+func GetTopUTMSourcesSince(since time.Time, limit int) []NamedCount {
+	statsLock.RLock()
+	defer statsLock.RUnlock()
+	return topNamedCounts(sumNestedSince(stats.DailyUTM, since.Format("2006-01-02")), limit)
+}
+
+func topNamedCounts(totals map[string]int, limit int) []NamedCount {
+	result := make([]NamedCount, 0, len(totals))
+	for name, n := range totals {
+		result = append(result, NamedCount{Name: name, Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result
 }
 
 // LoadStats 重新加载统计数据（用于数据恢复后）
@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// 统计导出格式
+const (
+	StatsFormatCSV  = "csv"
+	StatsFormatJSON = "json"
+)
+
+// 统计报表的维度：按天或按文章
+const (
+	StatsByDay  = "day"
+	StatsByPost = "post"
+)
+
+// maxStatsReportDays 单次报表最多覆盖的天数
+const maxStatsReportDays = 3660
+
+// StatsReport 一段时间内的访问统计。超过保留期的数据只有月汇总，
+// 与时间段有交集的月份整月计入 Months、Posts、Referrers 和 UTMSources
+type StatsReport struct {
+	From       string       `json:"from"`
+	To         string       `json:"to"`
+	Views      int          `json:"views"`
+	Visitors   int          `json:"visitors"` // 每日独立访客数之和
+	Days       []DayStats   `json:"days"`
+	Months     []DayStats   `json:"months,omitempty"` // 已按月汇总的数据，Date 为 2006-01
+	Posts      []PostStats  `json:"posts"`
+	Referrers  []NamedCount `json:"referrers"`
+	UTMSources []NamedCount `json:"utm_sources"`
+}
+
+// DayStats 某一天（或某月）的访问量
+type DayStats struct {
+	Date     string `json:"date"`
+	Views    int    `json:"views"`
+	Visitors int    `json:"visitors"`
+}
+
+// PostStats 文章在时间段内的访问量，文章已删除时只有 ID
+type PostStats struct {
+	ID    string `json:"id"`
+	Title string `json:"title,omitempty"`
+	URL   string `json:"url,omitempty"`
+	Views int    `json:"views"`
+}
+
+// ParseStatsRange 解析 2006-01-02 格式的起止日期，为空时默认最近 30 天
+func ParseStatsRange(from, to string) (time.Time, time.Time, error) {
+	now := time.Now()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("结束日期格式应为 YYYY-MM-DD")
+		}
+		end = t
+	}
+	start := end.AddDate(0, 0, -29)
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, now.Location())
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("开始日期格式应为 YYYY-MM-DD")
+		}
+		start = t
+	}
+	if start.After(end) {
+		return time.Time{}, time.Time{}, fmt.Errorf("开始日期不能晚于结束日期")
+	}
+	if end.Sub(start) > maxStatsReportDays*24*time.Hour {
+		return time.Time{}, time.Time{}, fmt.Errorf("时间跨度不能超过 %d 天", maxStatsReportDays)
+	}
+	return start, end, nil
+}
+
+// GetStatsReport 汇总 from 到 to（含）之间的访问统计
+func GetStatsReport(from, to time.Time) StatsReport {
+	first, last := from.Format("2006-01-02"), to.Format("2006-01-02")
+	report := StatsReport{From: first, To: last}
+
+	statsLock.RLock()
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		date := day.Format("2006-01-02")
+		d := DayStats{Date: date, Views: stats.DailyViews[date], Visitors: stats.DailyVisitors[date]}
+		report.Days = append(report.Days, d)
+		report.Views += d.Views
+		report.Visitors += d.Visitors
+	}
+
+	inRange := func(key string) bool {
+		if len(key) == len("2006-01") {
+			return key >= first[:7] && key <= last[:7]
+		}
+		return key >= first && key <= last
+	}
+	for month, views := range stats.MonthlyViews {
+		if inRange(month) {
+			m := DayStats{Date: month, Views: views, Visitors: stats.MonthlyVisitors[month]}
+			report.Months = append(report.Months, m)
+			report.Views += m.Views
+			report.Visitors += m.Visitors
+		}
+	}
+	sort.Slice(report.Months, func(i, j int) bool { return report.Months[i].Date < report.Months[j].Date })
+
+	posts := sumNestedInRange(inRange, stats.DailyPosts, stats.MonthlyPosts)
+	referrers := sumNestedInRange(inRange, stats.DailyReferrers, stats.MonthlyReferrers)
+	utm := sumNestedInRange(inRange, stats.DailyUTM, stats.MonthlyUTM)
+	statsLock.RUnlock()
+
+	for id, views := range posts {
+		p := PostStats{ID: id, Views: views}
+		if post := GetPostByID(id); post != nil {
+			p.Title = post.Title
+			p.URL = absoluteURL(post.Permalink())
+		}
+		report.Posts = append(report.Posts, p)
+	}
+	sort.Slice(report.Posts, func(i, j int) bool {
+		if report.Posts[i].Views != report.Posts[j].Views {
+			return report.Posts[i].Views > report.Posts[j].Views
+		}
+		return report.Posts[i].ID < report.Posts[j].ID
+	})
+	report.Referrers = topNamedCounts(referrers, 0)
+	report.UTMSources = topNamedCounts(utm, 0)
+	return report
+}
+
+func sumNestedInRange(inRange func(string) bool, maps ...map[string]map[string]int) map[string]int {
+	totals := make(map[string]int)
+	for _, m := range maps {
+		for key, counts := range m {
+			if !inRange(key) {
+				continue
+			}
+			for name, n := range counts {
+				totals[name] += n
+			}
+		}
+	}
+	return totals
+}
+
+// ExportStats 导出报表，by 为 day 时每行一天（及已汇总的月份），为 post 时每行一篇文章
+func ExportStats(report StatsReport, format, by string) ([]byte, error) {
+	switch format {
+	case StatsFormatJSON:
+		return json.MarshalIndent(report, "", "  ")
+	case StatsFormatCSV:
+	default:
+		return nil, fmt.Errorf("不支持的导出格式 %q，支持 csv、json", format)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	switch by {
+	case StatsByDay, "":
+		w.Write([]string{"date", "views", "visitors"})
+		for _, d := range append(append([]DayStats{}, report.Months...), report.Days...) {
+			w.Write([]string{d.Date, strconv.Itoa(d.Views), strconv.Itoa(d.Visitors)})
+		}
+	case StatsByPost:
+		w.Write([]string{"post_id", "title", "url", "views"})
+		for _, p := range report.Posts {
+			w.Write([]string{p.ID, p.Title, p.URL, strconv.Itoa(p.Views)})
+		}
+	default:
+		return nil, fmt.Errorf("不支持的维度 %q，支持 day、post", by)
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func setupStats(t testing.TB) {
+	t.Helper()
+	setupTestDir(t)
+	loadStats()
+}
+
+func TestFlushStatsRoundTrip(t *testing.T) {
+	setupStats(t)
+
+	// 先写一次，留一个硬链接指向旧文件：原子替换后旧文件内容不应被改写
+	RecordView("", Visit{IP: "10.0.0.1", UserAgent: "Mozilla/5.0"})
+	if err := FlushStats(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(statsFile, "data/stats.old"); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile("data/stats.old")
+
+	visits := []struct {
+		postID string
+		v      Visit
+	}{
+		{"01POST", Visit{IP: "10.0.0.2", UserAgent: "Mozilla/5.0", Referrer: "https://www.example.com/a", Host: "blog.example.com"}},
+		{"01POST", Visit{IP: "10.0.0.3", UserAgent: "Mozilla/5.0", UTMSource: "Newsletter"}},
+		{"01OTHER", Visit{IP: "10.0.0.2", UserAgent: "Mozilla/5.0"}},
+		{"01POST", Visit{IP: "10.0.0.4", UserAgent: "Googlebot/2.1"}},
+	}
+	for _, v := range visits {
+		RecordView(v.postID, v.v)
+	}
+	if !statsDirty {
+		t.Fatal("RecordView did not mark stats dirty")
+	}
+	want := GetStats()
+
+	if err := FlushStats(); err != nil {
+		t.Fatal(err)
+	}
+	if statsDirty {
+		t.Error("FlushStats did not clear the dirty flag")
+	}
+	if after, _ := os.ReadFile("data/stats.old"); string(after) != string(before) {
+		t.Error("stats file was rewritten in place instead of replaced")
+	}
+	if tmp, _ := filepath.Glob("data/.stats.json.tmp-*"); len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+
+	loadStats()
+	got := GetStats()
+	today := time.Now().Format("2006-01-02")
+	checks := []struct {
+		name      string
+		got, want int
+	}{
+		{"total", got.TotalViews, 4},
+		{"bots", got.BotViews, want.BotViews},
+		{"daily", got.DailyViews[today], want.DailyViews[today]},
+		{"visitors", got.DailyVisitors[today], want.DailyVisitors[today]},
+		{"top post", got.TopPosts["01POST"], 2},
+		{"daily post", got.DailyPosts[today]["01OTHER"], 1},
+		{"referrer", got.DailyReferrers[today]["example.com"], 1},
+		{"utm", got.DailyUTM[today]["newsletter"], 1},
+	}
+	for _, c := range checks {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+
+	// 没有新的访问时不写盘
+	os.Remove(statsFile)
+	if err := FlushStats(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(statsFile); !os.IsNotExist(err) {
+		t.Error("FlushStats wrote without pending changes")
+	}
+}
+
+// BenchmarkRecordView 并发记录访问的吞吐量，每 1000 次访问写一次盘，模拟定期刷新
+func BenchmarkRecordView(b *testing.B) {
+	setupStats(b)
+	posts := []string{"", "01POSTA", "01POSTB", "01POSTC"}
+	var n atomic.Int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := n.Add(1)
+			RecordView(posts[i%int64(len(posts))], Visit{
+				IP:        fmt.Sprintf("10.0.%d.%d", i/256%256, i%256),
+				UserAgent: "Mozilla/5.0 (X11; Linux x86_64)",
+				Referrer:  "https://news.example.com/item",
+				Host:      "blog.example.com",
+			})
+			if i%1000 == 0 {
+				if err := FlushStats(); err != nil {
+					b.Error(err)
+				}
+			}
+		}
+	})
+}
+
+func TestStatsRetentionDays(t *testing.T) {
+	setupTestDir(t)
+	tests := []struct{ configured, want int }{
+		{0, 400},
+		{-5, 400},
+		{30, statsMinRetentionDays},
+		{365, 365},
+		{800, 800},
+	}
+	for _, tt := range tests {
+		AppConfig.Stats.RetentionDays = tt.configured
+		if got := statsRetentionDays(); got != tt.want {
+			t.Errorf("retention_days %d: got %d, want %d", tt.configured, got, tt.want)
+		}
+	}
+}
+
+func TestCompactStats(t *testing.T) {
+	setupStats(t)
+	AppConfig.Stats.RetentionDays = 400
+
+	day := func(daysAgo int) string { return time.Now().AddDate(0, 0, -daysAgo).Format("2006-01-02") }
+	old1, old2, kept := day(500), day(501), day(399)
+	month := old1[:7]
+	if old2[:7] != month {
+		// 两天跨月时改用同一个月内的另一天
+		old2 = day(499)
+	}
+
+	statsLock.Lock()
+	stats.DailyViews = map[string]int{old1: 3, old2: 4, kept: 5}
+	stats.DailyVisitors = map[string]int{old1: 1, old2: 2, kept: 3}
+	stats.DailyPosts = map[string]map[string]int{old1: {"01A": 2, "01B": 1}, old2: {"01A": 4}, kept: {"01A": 5}}
+	stats.DailyReferrers = map[string]map[string]int{old1: {"example.com": 3}, kept: {"example.com": 1}}
+	stats.DailyUTM = map[string]map[string]int{old2: {"newsletter": 4}}
+	stats.MonthlyViews = map[string]int{month: 10} // 已有的按月数据累加而不是覆盖
+	statsDirty = false
+	compactStats()
+	got := stats
+	dirty := statsDirty
+	statsLock.Unlock()
+
+	if !dirty {
+		t.Error("compaction did not mark stats dirty")
+	}
+
+	counts := []struct {
+		name string
+		got  int
+		want int
+	}{
+		{"daily views kept", got.DailyViews[kept], 5},
+		{"daily views compacted", len(got.DailyViews), 1},
+		{"monthly views", got.MonthlyViews[month], 17},
+		{"monthly visitors", got.MonthlyVisitors[month], 3},
+		{"monthly posts 01A", got.MonthlyPosts[month]["01A"], 6},
+		{"monthly posts 01B", got.MonthlyPosts[month]["01B"], 1},
+		{"daily posts kept", got.DailyPosts[kept]["01A"], 5},
+		{"daily posts compacted", len(got.DailyPosts), 1},
+		{"monthly referrers", got.MonthlyReferrers[month]["example.com"], 3},
+		{"daily referrers kept", got.DailyReferrers[kept]["example.com"], 1},
+		{"monthly utm", got.MonthlyUTM[month]["newsletter"], 4},
+		{"daily utm compacted", len(got.DailyUTM), 0},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s = %d, want %d", c.name, c.got, c.want)
+		}
+	}
+
+	// 没有过期数据时不应标记为需要写盘
+	statsLock.Lock()
+	statsDirty = false
+	compactStats()
+	dirty = statsDirty
+	statsLock.Unlock()
+	if dirty {
+		t.Error("second compaction marked stats dirty")
+	}
+}
+
+func TestDailyViewsChartCoversLongestRange(t *testing.T) {
+	setupStats(t)
+	AppConfig.Stats.RetentionDays = 30 // 低于最长图表范围，按 365 天保留
+
+	oldest := time.Now().AddDate(0, 0, -364).Format("2006-01-02")
+	statsLock.Lock()
+	stats.DailyViews = map[string]int{oldest: 7}
+	compactStats()
+	statsLock.Unlock()
+
+	labels, views, _ := GetDailyViewsChart(365)
+	if len(labels) != 365 || views[0] != 7 {
+		t.Errorf("oldest day of the 365-day chart = %d (of %d points), want 7", views[0], len(labels))
+	}
+}
@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"net/url"
+	"strings"
+)
+
+// Visit 一次访问的来源信息，只用于计数，不会原样保存
+type Visit struct {
+	IP        string
+	UserAgent string
+	Referrer  string
+	UTMSource string
+	Host      string // 请求的 Host，用于排除站内跳转
+}
+
+// 常见爬虫、预览抓取和命令行工具的 User-Agent 特征（小写）
+var botUserAgents = []string{
+	"bot", "crawl", "spider", "slurp", "mediapartners", "facebookexternalhit",
+	"embedly", "preview", "feedfetcher", "feedly", "rss", "monitor", "uptime",
+	"lighthouse", "headless", "phantomjs", "curl/", "wget/", "python-", "go-http-client",
+	"java/", "okhttp", "httpclient", "libwww", "scrapy", "node-fetch", "axios/",
+}
+
+// IsBot 按 User-Agent 判断是否为爬虫或脚本，空 User-Agent 也视为爬虫
+func IsBot(userAgent string) bool {
+	ua := strings.ToLower(strings.TrimSpace(userAgent))
+	if ua == "" {
+		return true
+	}
+	for _, s := range botUserAgents {
+		if strings.Contains(ua, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// 独立访客按 当天随机盐 + IP + User-Agent 的哈希识别：盐只在内存中，
+// 每天更换，哈希也不写盘，无法反推访客身份，也无法跨天关联。
+// 代价是重启当天已出现过的访客会被再计一次
+var (
+	visitorDay  string
+	visitorSalt []byte
+	visitorSeen map[uint64]struct{}
+)
+
+// isNewVisitor 判断今天是否第一次见到该访客，调用方需持有 statsLock 写锁
+func isNewVisitor(today string, v Visit) bool {
+	if visitorDay != today {
+		visitorDay = today
+		visitorSalt = make([]byte, 32)
+		rand.Read(visitorSalt)
+		visitorSeen = make(map[uint64]struct{})
+	}
+
+	h := sha256.New()
+	h.Write(visitorSalt)
+	h.Write([]byte(v.IP))
+	h.Write([]byte{0})
+	h.Write([]byte(v.UserAgent))
+	key := binary.BigEndian.Uint64(h.Sum(nil))
+
+	if _, ok := visitorSeen[key]; ok {
+		return false
+	}
+	visitorSeen[key] = struct{}{}
+	return true
+}
+
+// referrerDomain 提取来源域名（去掉 www.），站内跳转和无法解析的来源返回空
+func referrerDomain(referrer, host string) string {
+	if referrer == "" {
+		return ""
+	}
+	u, err := url.Parse(referrer)
+	if err != nil || !isHTTPURL(u) {
+		return ""
+	}
+	domain := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if domain == "" || domain == strings.TrimPrefix(strings.ToLower(hostWithoutPort(host)), "www.") {
+		return ""
+	}
+	if base, err := url.Parse(AppConfig.Site.BaseURL); err == nil && domain == strings.TrimPrefix(strings.ToLower(base.Hostname()), "www.") {
+		return ""
+	}
+	return domain
+}
+
+func hostWithoutPort(host string) string {
+	if u, err := url.Parse("//" + host); err == nil {
+		return u.Hostname()
+	}
+	return host
+}
@@ -1,142 +1,337 @@
 package pkg
 
 import (
-	"log"
+	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/blevesearch/bleve/v2"
 )
 
+// contentSnapshot 一次载入得到的全部文章数据。发布后不再修改（包括其中的 *Post），
+// 重新载入时构建新的快照并整体替换，读取方不需要加锁
+type contentSnapshot struct {
+	posts      []*Post            // 已发布文章，按置顶、权重和时间排序
+	byKey      map[string]*Post   // 小写的 分类/slug -> 文章（含草稿）
+	byID       map[string]*Post   // 文章 ID -> 文章（含草稿）
+	byPath     map[string]*Post   // 文件路径 -> 文章（含草稿）
+	drafts     int                // 草稿数
+	tags       []TagInfo          // 已发布文章的标签，按名称排序
+	byTag      map[string][]*Post // 标签 -> 已发布文章，顺序同 posts
+	byCategory map[string][]*Post // 分类 -> 已发布文章，置顶优先，其余按时间倒序
+}
+
+// searchIndex 当前的搜索索引及其目录
+type searchIndex struct {
+	index bleve.Index
+	dir   string
+}
+
 var (
-	Posts     []*Post
-	PostsMap  map[string]*Post
-	Index     bleve.Index
-	storeLock sync.RWMutex
+	snapshot atomic.Pointer[contentSnapshot]
+	index    atomic.Pointer[searchIndex]
+
+	loadLock  sync.Mutex // 串行化 LoadAllPosts，避免较早开始的载入覆盖较新的结果
+	indexLock sync.Mutex // 串行化 InitSearchIndex
+	indexGen  int
 
 	// ContentCache 缓存已解析的 HTML 内容
 	// Key: FilePath, Value: string (HTML)
 	contentCache sync.Map
 )
 
+// retiredIndexGrace 旧索引替换后保留的时间，让进行中的搜索完成后再关闭
+const retiredIndexGrace = time.Minute
+
+var emptySnapshot = &contentSnapshot{
+	byKey:      map[string]*Post{},
+	byID:       map[string]*Post{},
+	byPath:     map[string]*Post{},
+	byTag:      map[string][]*Post{},
+	byCategory: map[string][]*Post{},
+}
+
+// currentSnapshot 当前的文章快照，尚未载入时返回空快照
+func currentSnapshot() *contentSnapshot {
+	if s := snapshot.Load(); s != nil {
+		return s
+	}
+	return emptySnapshot
+}
+
 func InitStore() {
-	PostsMap = make(map[string]*Post)
 	LoadAllPosts()
 	InitSearchIndex()
+	storeReady.Store(true)
 }
 
-// LoadAllPosts 将 Markdown 元数据载入内存，按时间倒序排列
+// LoadAllPosts 重新载入全部 Markdown 文章，构建新快照后原子替换
 func LoadAllPosts() {
-	storeLock.Lock()
-	defer storeLock.Unlock()
+	start := time.Now()
+	defer func() { contentReloadDuration.Observe(time.Since(start)) }()
+
+	loadLock.Lock()
+	defer loadLock.Unlock()
+
+	s := &contentSnapshot{
+		byKey:      make(map[string]*Post),
+		byID:       make(map[string]*Post),
+		byPath:     make(map[string]*Post),
+		byTag:      make(map[string][]*Post),
+		byCategory: make(map[string][]*Post),
+	}
 
-	Posts = nil
-	PostsMap = make(map[string]*Post)
+	var skipped int
+	var firstSkipped string
 
 	basePath := filepath.Join("content", "blog")
 	err := filepath.Walk(basePath, func(path string, info os.FileInfo, err error) error {
+		if err != nil && path == basePath {
+			return err
+		}
 		if err != nil || info.IsDir() || filepath.Ext(path) != ".md" {
 			return nil
 		}
 
 		post, err := ParseMarkdownFile(path)
 		if err != nil {
+			slog.Warn("skip post", "path", path, "err", err)
+			if skipped == 0 {
+				firstSkipped = fmt.Sprintf("%s: %v", path, err)
+			}
+			skipped++
 			return nil
 		}
-		
-		// 草稿文章只加入 PostsMap（后台可见），不加入 Posts（前台不可见）
-		key := strings.ToLower(post.Category + "/" + post.Slug)
-		PostsMap[key] = post
-		
-		if !post.Draft {
-			Posts = append(Posts, post)
+
+		if post.ID == "" {
+			post.ID, post.legacyID = legacyPostID(post), true
+		}
+		if other, ok := s.byID[post.ID]; ok {
+			slog.Warn("duplicate post id", "id", post.ID, "path", other.FilePath, "duplicate", post.FilePath)
+		} else {
+			s.byID[post.ID] = post
+		}
+
+		// 草稿只能按 key、ID、路径查到（后台可见），不进入已发布列表（前台不可见）
+		s.byKey[strings.ToLower(post.Category+"/"+post.Slug)] = post
+		s.byPath[filepath.Clean(post.FilePath)] = post
+		if post.Draft {
+			s.drafts++
+		} else {
+			s.posts = append(s.posts, post)
 		}
 		return nil
 	})
 
 	if err != nil {
-		log.Printf("Error walking content directory: %v", err)
+		slog.Error("error walking content directory", "err", err)
+	}
+	recordReload(err, skipped, firstSkipped)
+
+	// 全部文章载入后再解析 Wiki 链接并计算反向链接
+	for _, post := range s.byKey {
+		if len(post.WikiLinks) == 0 {
+			continue
+		}
+		var unresolved []string
+		post.Content, unresolved = resolveWikiLinks(post.Content, s.byKey)
+		for _, target := range unresolved {
+			slog.Warn("unresolved wiki link", "target", target, "path", post.FilePath)
+		}
 	}
+	buildBacklinks(s.byKey)
 
-	// 按置顶和时间排序：置顶优先，然后按时间倒序
-	sort.Slice(Posts, func(i, j int) bool {
-		if Posts[i].Pinned != Posts[j].Pinned {
-			return Posts[i].Pinned // 置顶的排前面
+	// 按置顶、权重和时间排序：置顶优先，设置了 weight 的按权重升序，其余按时间倒序
+	sort.Slice(s.posts, func(i, j int) bool {
+		a, b := s.posts[i], s.posts[j]
+		if a.Pinned != b.Pinned {
+			return a.Pinned // 置顶的排前面
+		}
+		if a.Weight != b.Weight {
+			if a.Weight == 0 || b.Weight == 0 {
+				return b.Weight == 0
+			}
+			return a.Weight < b.Weight
 		}
-		return Posts[i].Date.After(Posts[j].Date)
+		return a.Date.After(b.Date)
 	})
+	buildSnapshotIndexes(s)
+
+	snapshot.Store(s)
+
+	// 链接目标可能已变化，清空渲染缓存
+	contentCache.Range(func(key, _ interface{}) bool {
+		contentCache.Delete(key)
+		return true
+	})
+	InvalidatePageCache()
+}
+
+// buildSnapshotIndexes 计算标签和分类索引
+func buildSnapshotIndexes(s *contentSnapshot) {
+	tagCounts := make(map[string]int)
+	for _, post := range s.posts {
+		for _, tag := range post.Tags {
+			if tagCounts[tag] == 0 || s.byTag[tag][len(s.byTag[tag])-1] != post {
+				s.byTag[tag] = append(s.byTag[tag], post)
+			}
+			tagCounts[tag]++
+		}
+		s.byCategory[post.Category] = append(s.byCategory[post.Category], post)
+	}
+
+	s.tags = make([]TagInfo, 0, len(tagCounts))
+	for name, count := range tagCounts {
+		s.tags = append(s.tags, TagInfo{Name: name, PostCount: count})
+	}
+	sort.Slice(s.tags, func(i, j int) bool { return s.tags[i].Name < s.tags[j].Name })
+
+	for _, posts := range s.byCategory {
+		sort.SliceStable(posts, func(i, j int) bool {
+			if posts[i].Pinned != posts[j].Pinned {
+				return posts[i].Pinned
+			}
+			return posts[i].Date.After(posts[j].Date)
+		})
+	}
+}
+
+// PublishedPosts 全部已发布文章，按置顶、权重和时间排序。返回的切片属于快照，不得修改
+func PublishedPosts() []*Post {
+	posts := currentSnapshot().posts
+	return posts[:len(posts):len(posts)]
+}
+
+// PostCounts 已发布文章数和草稿数
+func PostCounts() (published, drafts int) {
+	s := currentSnapshot()
+	return len(s.posts), s.drafts
+}
+
+// GetPost 按分类和 slug 查找文章（含草稿），大小写不敏感
+func GetPost(category, slug string) *Post {
+	return currentSnapshot().byKey[strings.ToLower(category+"/"+slug)]
+}
+
+// GetPostsByCategory 分类下的已发布文章，置顶优先，其余按时间倒序
+func GetPostsByCategory(category string) []*Post {
+	posts := currentSnapshot().byCategory[category]
+	return posts[:len(posts):len(posts)]
+}
+
+// GetPostByID 按稳定 ID 查找文章（含草稿）
+func GetPostByID(id string) *Post {
+	return currentSnapshot().byID[id]
+}
+
+// GetPostByFilePath 按文件路径查找文章（含草稿）
+func GetPostByFilePath(path string) *Post {
+	return currentSnapshot().byPath[filepath.Clean(path)]
 }
 
 // GetCachedContent 获取渲染后的 HTML，如果不存在则解析并存入缓存
 func GetCachedContent(post *Post) string {
 	if val, ok := contentCache.Load(post.FilePath); ok {
+		markdownCache.Inc("hit")
 		return val.(string)
 	}
+	markdownCache.Inc("miss")
 
 	// 缓存失效或不存在，执行解析
-	log.Printf("Cache Miss: Rendering Markdown for %s", post.FilePath)
+	slog.Debug("markdown cache miss", "path", post.FilePath)
 	freshPost, err := ParseMarkdownFile(post.FilePath)
 	if err != nil {
 		return "Error rendering content"
 	}
 
-	contentCache.Store(post.FilePath, freshPost.Content)
-	return freshPost.Content
+	content := ResolveWikiLinks(freshPost.Content)
+	contentCache.Store(post.FilePath, content)
+	return content
 }
 
 // InvalidateCache 当文件保存时调用
 func InvalidateCache(filePath string) {
 	contentCache.Delete(filePath)
-	log.Printf("Cache Invalidated: %s", filePath)
+	slog.Debug("markdown cache invalidated", "path", filePath)
 }
 
+// InitSearchIndex 为当前快照的已发布文章建立搜索索引，建好后原子替换旧索引。
+// 每次建立在 index_path 下的新目录，旧索引延迟关闭并删除，进行中的搜索不受影响
 func InitSearchIndex() {
+	indexLock.Lock()
+	defer indexLock.Unlock()
+
 	indexPath := AppConfig.Search.IndexPath
-	if Index != nil { Index.Close() }
-	os.RemoveAll(indexPath)
+	if indexGen == 0 {
+		// 启动时清掉上次运行留下的索引
+		os.RemoveAll(indexPath)
+	}
+	indexGen++
+	dir := filepath.Join(indexPath, strconv.Itoa(indexGen))
 
-	mapping := bleve.NewIndexMapping()
-	var err error
-	Index, err = bleve.New(indexPath, mapping)
-	if err != nil { log.Fatalf("Error creating index: %v", err) }
+	idx, err := bleve.New(dir, bleve.NewIndexMapping())
+	if err != nil {
+		slog.Error("error creating search index", "err", err)
+		os.Exit(1)
+	}
+	batch := idx.NewBatch()
+	for _, post := range PublishedPosts() {
+		batch.Index(post.ID, post)
+	}
+	if err := idx.Batch(batch); err != nil {
+		slog.Error("error indexing posts", "err", err)
+	}
 
-	for _, post := range Posts {
-		Index.Index(post.Slug, post)
+	if old := index.Swap(&searchIndex{index: idx, dir: dir}); old != nil {
+		time.AfterFunc(retiredIndexGrace, func() {
+			old.index.Close()
+			os.RemoveAll(old.dir)
+		})
 	}
 }
 
+// searchReady 搜索索引是否已建立
+func searchReady() bool {
+	return index.Load() != nil
+}
+
 func SearchPosts(query string) ([]*Post, error) {
+	start := time.Now()
+	defer func() { searchDuration.Observe(time.Since(start)) }()
+
+	current := index.Load()
+	if current == nil {
+		return nil, nil
+	}
 	searchQuery := bleve.NewMatchQuery(query)
 	searchRequest := bleve.NewSearchRequest(searchQuery)
-	results, err := Index.Search(searchRequest)
+	results, err := current.index.Search(searchRequest)
 	if err != nil {
 		return nil, err
 	}
 
+	s := currentSnapshot()
 	var foundPosts []*Post
 	for _, hit := range results.Hits {
-		for _, post := range Posts {
-			if post.Slug == hit.ID {
-				foundPosts = append(foundPosts, post)
-				break
-			}
+		if post, ok := s.byID[hit.ID]; ok && !post.Draft {
+			foundPosts = append(foundPosts, post)
 		}
 	}
 	return foundPosts, nil
 }
 
-	
-
-
 // GetPaginatedPosts 返回分页后的文章列表
 func GetPaginatedPosts(page, perPage int) ([]*Post, int) {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
+	posts := currentSnapshot().posts
 
-	total := len(Posts)
+	total := len(posts)
 	if perPage <= 0 {
 		perPage = 10
 	}
@@ -152,23 +347,20 @@ func GetPaginatedPosts(page, perPage int) ([]*Post, int) {
 		end = total
 	}
 
-	return Posts[start:end], totalPages
+	return posts[start:end:end], totalPages
 }
 
-
 // GetAdjacentPosts 获取上一篇和下一篇文章
 func GetAdjacentPosts(currentPost *Post) (prev *Post, next *Post) {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
-
-	for i, p := range Posts {
+	posts := currentSnapshot().posts
+	for i, p := range posts {
 		if p.FilePath == currentPost.FilePath {
-			// Posts 按时间倒序，所以 i-1 是更新的文章（下一篇），i+1 是更旧的（上一篇）
+			// posts 按时间倒序，所以 i-1 是更新的文章（下一篇），i+1 是更旧的（上一篇）
 			if i > 0 {
-				next = Posts[i-1]
+				next = posts[i-1]
 			}
-			if i < len(Posts)-1 {
-				prev = Posts[i+1]
+			if i < len(posts)-1 {
+				prev = posts[i+1]
 			}
 			break
 		}
@@ -176,55 +368,24 @@ func GetAdjacentPosts(currentPost *Post) (prev *Post, next *Post) {
 	return
 }
 
-
 // TagInfo 标签信息
 type TagInfo struct {
 	Name      string
 	PostCount int
 }
 
-// ListTags 获取所有标签及文章数
+// ListTags 获取所有标签及文章数，按名称排序
 func ListTags() []TagInfo {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
-
-	tagMap := make(map[string]int)
-	for _, post := range Posts {
-		for _, tag := range post.Tags {
-			tagMap[tag]++
-		}
-	}
-
-	tags := make([]TagInfo, 0, len(tagMap))
-	for name, count := range tagMap {
-		tags = append(tags, TagInfo{Name: name, PostCount: count})
-	}
-	return tags
+	return append([]TagInfo(nil), currentSnapshot().tags...)
 }
 
 // GetPostsByTag 获取指定标签的文章
 func GetPostsByTag(tag string) []*Post {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
-
-	var posts []*Post
-	for _, post := range Posts {
-		for _, t := range post.Tags {
-			if t == tag {
-				posts = append(posts, post)
-				break
-			}
-		}
-	}
-	return posts
+	return append([]*Post(nil), currentSnapshot().byTag[tag]...)
 }
 
-
 // GetRelatedPosts 获取相关文章（基于标签匹配）
 func GetRelatedPosts(currentPost *Post, limit int) []*Post {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
-
 	if len(currentPost.Tags) == 0 {
 		return nil
 	}
@@ -241,7 +402,7 @@ func GetRelatedPosts(currentPost *Post, limit int) []*Post {
 		currentTags[t] = true
 	}
 
-	for _, post := range Posts {
+	for _, post := range currentSnapshot().posts {
 		if post.FilePath == currentPost.FilePath {
 			continue
 		}
@@ -272,21 +433,17 @@ func GetRelatedPosts(currentPost *Post, limit int) []*Post {
 	return result
 }
 
-
 // GetAllPostsIncludingDrafts 获取所有文章（包括草稿），用于后台管理
 func GetAllPostsIncludingDrafts() []*Post {
-	storeLock.RLock()
-	defer storeLock.RUnlock()
-
 	var allPosts []*Post
-	for _, post := range PostsMap {
+	for _, post := range currentSnapshot().byKey {
 		allPosts = append(allPosts, post)
 	}
-	
+
 	// 按时间倒序排列
 	sort.Slice(allPosts, func(i, j int) bool {
 		return allPosts[i].Date.After(allPosts[j].Date)
 	})
-	
+
 	return allPosts
 }
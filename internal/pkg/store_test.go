@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// writeRaceFixture 写入几篇带标签的文章，rev 用于让每次重新载入的内容都不同
+func writeRaceFixture(t *testing.T, rev int) {
+	t.Helper()
+	writeTestPost(t, "tech", "go", fmt.Sprintf("id: 01GO\ntitle: Go 并发 %d\ndate: 2026-01-02\ntags: [go, concurrency]", rev),
+		"goroutine 和 channel，参见 [[life/notes]]。")
+	writeTestPost(t, "tech", "rust", "id: 01RUST\ntitle: Rust\ndate: 2026-01-01\ntags: [rust]", "ownership")
+	writeTestPost(t, "life", "notes", "id: 01NOTES\ntitle: Notes\ndate: 2026-01-03\ntags: [go]", "日常")
+	writeTestPost(t, "life", "draft", "id: 01DRAFT\ntitle: Draft\ndate: 2026-01-04\ndraft: true", "草稿")
+}
+
+// TestConcurrentReloadAndReads 重新载入文章和搜索索引的同时并发读取，用 -race 运行
+func TestConcurrentReloadAndReads(t *testing.T) {
+	setupTestDir(t)
+	writeRaceFixture(t, 0)
+	loadTestPosts(t)
+
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for !done.Load() {
+				if post := GetPost("tech", "go"); post == nil || post.ID != "01GO" || len(post.Tags) != 2 {
+					errs <- fmt.Errorf("GetPost(tech, go) = %+v", post)
+					return
+				}
+				if post := GetPostByID("01DRAFT"); post == nil || !post.Draft {
+					errs <- fmt.Errorf("draft missing from ID lookup")
+					return
+				}
+				posts := PublishedPosts()
+				if len(posts) != 3 {
+					errs <- fmt.Errorf("PublishedPosts returned %d posts", len(posts))
+					return
+				}
+				for _, p := range posts {
+					_ = p.Title + p.Content
+					for _, b := range p.Backlinks {
+						_ = b.Title
+					}
+				}
+				if published, drafts := PostCounts(); published != 3 || drafts != 1 {
+					errs <- fmt.Errorf("PostCounts = %d, %d", published, drafts)
+					return
+				}
+				if tags := ListTags(); len(tags) != 3 {
+					errs <- fmt.Errorf("ListTags returned %d tags", len(tags))
+					return
+				}
+				if tagged := GetPostsByTag("go"); len(tagged) != 2 {
+					errs <- fmt.Errorf("GetPostsByTag(go) returned %d posts", len(tagged))
+					return
+				}
+				_ = GetPostsByCategory("tech")
+				if _, err := SearchPosts("goroutine"); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	for rev := 1; rev <= 20; rev++ {
+		writeRaceFixture(t, rev)
+		LoadAllPosts()
+		InitSearchIndex()
+	}
+	done.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if post := GetPost("tech", "go"); post.Title != "Go 并发 20" {
+		t.Errorf("latest reload not visible: title %q", post.Title)
+	}
+	if found, _ := SearchPosts("goroutine"); len(found) != 1 || found[0].ID != "01GO" {
+		t.Errorf("search after reload = %v", found)
+	}
+	if backlinks := GetPost("life", "notes").Backlinks; len(backlinks) != 1 || backlinks[0].ID != "01GO" {
+		t.Errorf("backlinks = %v", backlinks)
+	}
+}
@@ -0,0 +1,23 @@
+// 用固定向量校验 themes/pure/static/pow.js 与服务端 VerifyPoW 的算法一致：
+// 从 0 开始搜索，第一个满足难度的 nonce 必须与 pow_test.go 中的一致
+//
+//     node internal/pkg/testdata/pow_vector.js
+const fs = require('fs');
+const path = require('path');
+const vm = require('vm');
+
+const challenge = '0123456789abcdef01234567.1700000000.16.0123456789abcdef0123456789abcdef';
+const difficulty = 16;
+const want = '22270';
+
+const window = {};
+const src = fs.readFileSync(path.join(__dirname, '../../../themes/pure/static/pow.js'), 'utf8');
+vm.runInNewContext(src, { window, setTimeout, Uint32Array, Math, Promise, String });
+
+window.solvePoW(challenge, difficulty).then(nonce => {
+    if (nonce !== want) {
+        console.error(`pow.js: got nonce ${nonce}, want ${want}`);
+        process.exit(1);
+    }
+    console.log('ok');
+});
@@ -0,0 +1,565 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Webmention 类型，由来源页面的 microformats 决定
+const (
+	WebmentionMention = "mention"
+	WebmentionReply   = "reply"
+	WebmentionLike    = "like"
+	WebmentionRepost  = "repost"
+)
+
+// Webmention 其他站点对文章的提及，与评论一样需要审核
+type Webmention struct {
+	ID        string    `json:"id"`
+	PostID    string    `json:"post_id"`
+	Source    string    `json:"source"`
+	Target    string    `json:"target"`
+	Type      string    `json:"type"`
+	Author    string    `json:"author,omitempty"`
+	AuthorURL string    `json:"author_url,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	Content   string    `json:"content,omitempty"` // 纯文本摘要
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Approved  bool      `json:"approved"`
+	Spam      bool      `json:"spam,omitempty"`
+}
+
+// 接收 Webmention 时的校验错误
+var (
+	ErrWebmentionURL    = errors.New("source 和 target 必须是不同的 http(s) 地址")
+	ErrWebmentionTarget = errors.New("target 不是本站可接收 Webmention 的文章")
+	ErrWebmentionQueue  = errors.New("Webmention 队列已满，请稍后重试")
+)
+
+var (
+	webmentions     []Webmention
+	webmentionsLock sync.RWMutex
+	webmentionsFile = "data/webmentions.json"
+
+	verifyQueue chan webmentionRequest
+
+	// 与评论分开计数，一篇文章可能一次提及多篇本站文章
+	webmentionLimiter = newRateLimiter()
+)
+
+// 每个 IP 在窗口内最多发送的 Webmention 数
+const (
+	webmentionRateLimit  = 30
+	webmentionRateWindow = 10 * time.Minute
+)
+
+type webmentionRequest struct {
+	Source string
+	Target string
+	PostID string
+}
+
+// InitWebmention 载入已收到的 Webmention，启动校验和发送队列
+func InitWebmention() {
+	os.MkdirAll("data", 0755)
+	loadWebmentions()
+	loadSentWebmentions()
+
+	verifyQueue = make(chan webmentionRequest, 100)
+	go verifyWorker()
+	sendQueue = make(chan *webmentionJob, 100)
+	go sendWorker()
+}
+
+func loadWebmentions() {
+	webmentionsLock.Lock()
+	defer webmentionsLock.Unlock()
+
+	webmentions = []Webmention{}
+	data, err := os.ReadFile(webmentionsFile)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &webmentions)
+}
+
+func saveWebmentions() error {
+	InvalidatePageCache()
+	data, err := json.MarshalIndent(webmentions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(webmentionsFile, data, 0644)
+}
+
+// ========== 接收 ==========
+
+// AllowWebmentionFrom 按 IP 限流，允许时记录本次请求
+func AllowWebmentionFrom(ip string) bool {
+	return webmentionLimiter.allow(ip, webmentionRateLimit, webmentionRateWindow)
+}
+
+// ReceiveWebmention 校验请求参数并加入异步校验队列，requestHost 为请求的 Host，
+// 未配置 base_url 时用于判断 target 是否属于本站
+func ReceiveWebmention(source, target, requestHost string) error {
+	src, err1 := url.Parse(source)
+	tgt, err2 := url.Parse(target)
+	if err1 != nil || err2 != nil || !isHTTPURL(src) || !isHTTPURL(tgt) || stripFragment(source) == stripFragment(target) {
+		return ErrWebmentionURL
+	}
+	post := postForTarget(tgt, requestHost)
+	if post == nil {
+		return ErrWebmentionTarget
+	}
+
+	select {
+	case verifyQueue <- webmentionRequest{Source: source, Target: target, PostID: post.ID}:
+		return nil
+	default:
+		return ErrWebmentionQueue
+	}
+}
+
+func isHTTPURL(u *url.URL) bool {
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func stripFragment(raw string) string {
+	if i := strings.Index(raw, "#"); i >= 0 {
+		return raw[:i]
+	}
+	return raw
+}
+
+// postForTarget 找到 target 指向的已发布文章：主机需与 base_url 或请求的 Host 一致
+func postForTarget(target *url.URL, requestHost string) *Post {
+	path := target.Path
+	base, _ := url.Parse(AppConfig.Site.BaseURL)
+	switch {
+	case base != nil && base.Host != "" && strings.EqualFold(target.Host, base.Host):
+		path = strings.TrimPrefix(path, strings.TrimSuffix(base.Path, "/"))
+	case strings.EqualFold(target.Host, requestHost):
+	default:
+		return nil
+	}
+
+	for _, post := range PublishedPosts() {
+		if strings.EqualFold(post.Permalink(), path) {
+			return post
+		}
+	}
+	return nil
+}
+
+func verifyWorker() {
+	for req := range verifyQueue {
+		if err := verifyWebmention(req); err != nil {
+			slog.Info("webmention rejected", "source", req.Source, "err", err)
+		}
+	}
+}
+
+// verifyWebmention 抓取来源页面，确认其中确实链接了目标文章；
+// 来源页面已删除或不再包含链接时，移除之前收到的 Webmention
+func verifyWebmention(req webmentionRequest) error {
+	resp, err := webmentionClient().Get(req.Source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone || resp.StatusCode == http.StatusNotFound {
+		removeWebmention(req.Source, req.Target)
+		return fmt.Errorf("source returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("source returned %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	var info mentionInfo
+	if strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		info = parseMentionSource(body, req.Source, req.Target)
+	} else {
+		info.Linked = bytes.Contains(body, []byte(req.Target))
+	}
+	if !info.Linked {
+		removeWebmention(req.Source, req.Target)
+		return errors.New("source does not link to target")
+	}
+
+	return saveWebmention(req, info)
+}
+
+// saveWebmention 新增或更新 Webmention，同一来源重复发送时只更新内容
+func saveWebmention(req webmentionRequest, info mentionInfo) error {
+	webmentionsLock.Lock()
+	defer webmentionsLock.Unlock()
+
+	now := time.Now()
+	for i := range webmentions {
+		w := &webmentions[i]
+		if w.Source == req.Source && w.Target == req.Target {
+			w.Type, w.Author, w.AuthorURL = info.Type, info.Author, info.AuthorURL
+			w.Title, w.Content, w.UpdatedAt = info.Title, info.Content, now
+			return saveWebmentions()
+		}
+	}
+
+	webmentions = append(webmentions, Webmention{
+		ID:        NewULID(),
+		PostID:    req.PostID,
+		Source:    req.Source,
+		Target:    req.Target,
+		Type:      info.Type,
+		Author:    info.Author,
+		AuthorURL: info.AuthorURL,
+		Title:     info.Title,
+		Content:   info.Content,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Approved:  !webmentionNeedsModeration(req.Source),
+	})
+	slog.Info("webmention received", "source", req.Source, "target", req.Target)
+	return saveWebmentions()
+}
+
+// webmentionNeedsModeration 沿用评论审核模式：首次审核模式下同一站点已有通过的 Webmention 即直接发布，
+// 调用方需持有 webmentionsLock
+func webmentionNeedsModeration(source string) bool {
+	switch AppConfig.Comments.Moderation {
+	case ModerationAll:
+		return true
+	case ModerationFirstTime:
+		host := hostOf(source)
+		for _, w := range webmentions {
+			if w.Approved && !w.Spam && hostOf(w.Source) == host {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func hostOf(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return strings.ToLower(u.Hostname())
+	}
+	return ""
+}
+
+func removeWebmention(source, target string) {
+	webmentionsLock.Lock()
+	defer webmentionsLock.Unlock()
+
+	for i := range webmentions {
+		if webmentions[i].Source == source && webmentions[i].Target == target {
+			webmentions = append(webmentions[:i], webmentions[i+1:]...)
+			saveWebmentions()
+			return
+		}
+	}
+}
+
+// ========== 抓取 ==========
+
+var errPrivateAddress = errors.New("refusing to connect to a private address")
+
+// webmentionHTTP 抓取外部页面的 HTTP 客户端，全局共用以复用连接；
+// 默认拒绝连接内网和本机地址，防止借 Webmention 探测内网
+var webmentionHTTP = &http.Client{
+	Timeout: 20 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkDialAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       30 * time.Second,
+	},
+}
+
+func webmentionClient() *http.Client {
+	return webmentionHTTP
+}
+
+// cgnatPrefix 运营商级 NAT 共享地址（RFC 6598），云厂商常用于内部服务
+var cgnatPrefix = netip.MustParsePrefix("100.64.0.0/10")
+
+// checkDialAddress 在建立连接前检查解析出的 IP，未开启 allow_private 时拒绝内网和本机地址
+func checkDialAddress(network, address string, _ syscall.RawConn) error {
+	if AppConfig.Webmention.AllowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return errPrivateAddress
+	}
+	ip = ip.Unmap() // ::ffff:127.0.0.1 按 IPv4 判断
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		cgnatPrefix.Contains(ip) {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// mentionInfo 从来源页面解析出的信息
+type mentionInfo struct {
+	Linked    bool // 页面中有指向 target 的链接
+	Type      string
+	Author    string
+	AuthorURL string
+	Title     string
+	Content   string
+}
+
+// parseMentionSource 检查来源页面是否链接了 target，并从 h-entry 中提取作者、标题、摘要和类型
+func parseMentionSource(body []byte, source, target string) mentionInfo {
+	info := mentionInfo{Type: WebmentionMention}
+	doc, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return info
+	}
+
+	target = stripFragment(target)
+	var entry, pageTitle *html.Node
+	walkHTML(doc, func(n *html.Node) {
+		for _, key := range []string{"href", "src"} {
+			if v, ok := htmlAttr(n, key); ok && stripFragment(v) == target {
+				info.Linked = true
+			}
+		}
+		if entry == nil && hasClass(n, "h-entry") {
+			entry = n
+		}
+		if pageTitle == nil && n.Type == html.ElementNode && n.Data == "title" {
+			pageTitle = n
+		}
+	})
+	if pageTitle != nil {
+		info.Title = nodeText(pageTitle)
+	}
+	if entry == nil {
+		return info
+	}
+
+	var entryName string
+	walkHTML(entry, func(n *html.Node) {
+		switch {
+		case info.Author == "" && hasClass(n, "p-author"):
+			info.Author = nodeText(n)
+			if name := findClass(n, "p-name"); name != nil {
+				info.Author = nodeText(name)
+			}
+			if href, ok := htmlAttr(n, "href"); ok {
+				info.AuthorURL = href
+			} else if u := findClass(n, "u-url"); u != nil {
+				info.AuthorURL, _ = htmlAttr(u, "href")
+			}
+		case info.Content == "" && (hasClass(n, "e-content") || hasClass(n, "p-content")):
+			info.Content = truncateRunes(nodeText(n), 280)
+		case entryName == "" && hasClass(n, "p-name") && !insideClass(n, entry, "p-author"):
+			entryName = nodeText(n)
+		}
+		if href, ok := htmlAttr(n, "href"); ok && stripFragment(href) == target {
+			switch {
+			case hasClass(n, "u-in-reply-to"):
+				info.Type = WebmentionReply
+			case hasClass(n, "u-like-of"):
+				info.Type = WebmentionLike
+			case hasClass(n, "u-repost-of"):
+				info.Type = WebmentionRepost
+			}
+		}
+	})
+	if entryName != "" {
+		info.Title = entryName
+	}
+	// 作者链接按来源页面地址解析，只保留 http(s) 链接
+	raw := info.AuthorURL
+	info.AuthorURL = ""
+	if base, err := url.Parse(source); err == nil && raw != "" {
+		if u, err := url.Parse(raw); err == nil {
+			if u = base.ResolveReference(u); isHTTPURL(u) {
+				info.AuthorURL = u.String()
+			}
+		}
+	}
+	info.Title = truncateRunes(info.Title, 120)
+	return info
+}
+
+func walkHTML(n *html.Node, fn func(*html.Node)) {
+	fn(n)
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walkHTML(c, fn)
+	}
+}
+
+func htmlAttr(n *html.Node, key string) (string, bool) {
+	if n.Type != html.ElementNode {
+		return "", false
+	}
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val), true
+		}
+	}
+	return "", false
+}
+
+func hasClass(n *html.Node, class string) bool {
+	v, ok := htmlAttr(n, "class")
+	if !ok {
+		return false
+	}
+	for _, c := range strings.Fields(v) {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+func findClass(n *html.Node, class string) *html.Node {
+	var found *html.Node
+	walkHTML(n, func(c *html.Node) {
+		if found == nil && c != n && hasClass(c, class) {
+			found = c
+		}
+	})
+	return found
+}
+
+// insideClass n 是否位于 root 之下某个带 class 的元素内
+func insideClass(n, root *html.Node, class string) bool {
+	for p := n.Parent; p != nil && p != root; p = p.Parent {
+		if hasClass(p, class) {
+			return true
+		}
+	}
+	return false
+}
+
+func nodeText(n *html.Node) string {
+	var sb strings.Builder
+	walkHTML(n, func(c *html.Node) {
+		if c.Type == html.TextNode {
+			sb.WriteString(c.Data)
+		}
+	})
+	return strings.Join(strings.Fields(sb.String()), " ")
+}
+
+func truncateRunes(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	return string([]rune(s)[:max]) + "…"
+}
+
+// ========== 展示与审核 ==========
+
+// GetWebmentionsByPost 获取文章已通过审核的 Webmention，按时间顺序
+func GetWebmentionsByPost(postID string) []Webmention {
+	webmentionsLock.RLock()
+	defer webmentionsLock.RUnlock()
+
+	var result []Webmention
+	for _, w := range webmentions {
+		if w.PostID == postID && w.Approved && !w.Spam {
+			result = append(result, w)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.Before(result[j].CreatedAt)
+	})
+	return result
+}
+
+// GetAllWebmentions 获取全部 Webmention（后台用），按时间倒序
+func GetAllWebmentions() []Webmention {
+	webmentionsLock.RLock()
+	defer webmentionsLock.RUnlock()
+
+	result := make([]Webmention, len(webmentions))
+	copy(result, webmentions)
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].CreatedAt.After(result[j].CreatedAt)
+	})
+	return result
+}
+
+// ApproveWebmention 审核通过
+func ApproveWebmention(id string) error {
+	return updateWebmention(id, func(w *Webmention) {
+		w.Approved = true
+		w.Spam = false
+	})
+}
+
+// MarkWebmentionSpam 标记或取消标记垃圾 Webmention
+func MarkWebmentionSpam(id string, spam bool) error {
+	return updateWebmention(id, func(w *Webmention) {
+		w.Spam = spam
+		if spam {
+			w.Approved = false
+		}
+	})
+}
+
+func updateWebmention(id string, fn func(*Webmention)) error {
+	webmentionsLock.Lock()
+	defer webmentionsLock.Unlock()
+
+	for i := range webmentions {
+		if webmentions[i].ID == id {
+			fn(&webmentions[i])
+			return saveWebmentions()
+		}
+	}
+	return nil
+}
+
+// DeleteWebmention 删除 Webmention；来源再次发送时会重新收到
+func DeleteWebmention(id string) error {
+	webmentionsLock.Lock()
+	defer webmentionsLock.Unlock()
+
+	for i := range webmentions {
+		if webmentions[i].ID == id {
+			webmentions = append(webmentions[:i], webmentions[i+1:]...)
+			return saveWebmentions()
+		}
+	}
+	return nil
+}
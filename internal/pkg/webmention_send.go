@@ -0,0 +1,261 @@
+package pkg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// webmentionJob 待发送的 Webmention
+type webmentionJob struct {
+	Source string
+	Target string
+
+	attempts int
+}
+
+// 发送失败（网络错误或对方 5xx）后的重试间隔，用完即放弃
+var webmentionRetryDelays = []time.Duration{time.Minute, 10 * time.Minute, time.Hour}
+
+var errNoWebmentionEndpoint = errors.New("no webmention endpoint")
+
+var (
+	sendQueue chan *webmentionJob
+
+	sentWebmentions     = make(map[string][]string) // 文章 ID -> 上次发送过的目标链接
+	sentWebmentionsLock sync.Mutex
+	sentWebmentionsFile = "data/webmentions_sent.json"
+)
+
+func loadSentWebmentions() {
+	sentWebmentionsLock.Lock()
+	defer sentWebmentionsLock.Unlock()
+
+	data, err := os.ReadFile(sentWebmentionsFile)
+	if err != nil {
+		return
+	}
+	json.Unmarshal(data, &sentWebmentions)
+}
+
+func saveSentWebmentions() error {
+	data, err := json.MarshalIndent(sentWebmentions, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(sentWebmentionsFile, data, 0644)
+}
+
+// SendWebmentions 文章发布或更新后通知文中链接的外部站点；
+// 上次链接过、这次已删掉的站点也会收到通知，便于对方移除
+func SendWebmentions(post *Post) {
+	if !AppConfig.Webmention.Send || sendQueue == nil || post == nil || post.Draft {
+		return
+	}
+	if AppConfig.Site.BaseURL == "" {
+		slog.Warn("site.base_url is not set, skip sending webmentions", "path", post.FilePath)
+		return
+	}
+
+	source := absoluteURL(post.Permalink())
+	links := externalLinks(GetCachedContent(post), source)
+
+	sentWebmentionsLock.Lock()
+	previous := sentWebmentions[post.ID]
+	if len(links) > 0 {
+		sentWebmentions[post.ID] = links
+	} else {
+		delete(sentWebmentions, post.ID)
+	}
+	if err := saveSentWebmentions(); err != nil {
+		slog.Error("failed to save sent webmentions", "err", err)
+	}
+	sentWebmentionsLock.Unlock()
+
+	targets := append([]string{}, links...)
+	for _, old := range previous {
+		if !slices.Contains(links, old) {
+			targets = append(targets, old)
+		}
+	}
+	for _, target := range targets {
+		enqueueWebmention(&webmentionJob{Source: source, Target: target})
+	}
+}
+
+func enqueueWebmention(job *webmentionJob) {
+	select {
+	case sendQueue <- job:
+	default:
+		slog.Warn("webmention queue full, dropping", "source", job.Source, "target", job.Target)
+	}
+}
+
+func sendWorker() {
+	for job := range sendQueue {
+		retry, err := sendWebmention(job.Source, job.Target)
+		if err == nil {
+			slog.Info("webmention sent", "source", job.Source, "target", job.Target)
+			continue
+		}
+		if errors.Is(err, errNoWebmentionEndpoint) {
+			continue
+		}
+		if !retry || errors.Is(err, errPrivateAddress) || job.attempts >= len(webmentionRetryDelays) {
+			slog.Error("webmention failed", "target", job.Target, "err", err)
+			continue
+		}
+		delay := webmentionRetryDelays[job.attempts]
+		job.attempts++
+		slog.Warn("webmention failed, retrying", "target", job.Target, "retry_in", delay, "err", err)
+		time.AfterFunc(delay, func() { enqueueWebmention(job) })
+	}
+}
+
+// externalLinks 提取文章 HTML 中指向其他站点的 http(s) 链接，去重并保持顺序
+func externalLinks(content, source string) []string {
+	base, err := url.Parse(source)
+	if err != nil {
+		return nil
+	}
+	doc, err := html.Parse(strings.NewReader(content))
+	if err != nil {
+		return nil
+	}
+
+	var links []string
+	walkHTML(doc, func(n *html.Node) {
+		if n.Type != html.ElementNode || n.Data != "a" {
+			return
+		}
+		href, ok := htmlAttr(n, "href")
+		if !ok {
+			return
+		}
+		u, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		u = base.ResolveReference(u)
+		u.Fragment = ""
+		if !isHTTPURL(u) || strings.EqualFold(u.Host, base.Host) {
+			return
+		}
+		if link := u.String(); !slices.Contains(links, link) {
+			links = append(links, link)
+		}
+	})
+	return links
+}
+
+// sendWebmention 发现目标页面的接收端点并发送，retry 表示失败是否值得重试
+func sendWebmention(source, target string) (retry bool, err error) {
+	endpoint, err := discoverWebmentionEndpoint(target)
+	if err != nil {
+		return !errors.Is(err, errNoWebmentionEndpoint), err
+	}
+
+	resp, err := webmentionClient().PostForm(endpoint, url.Values{"source": {source}, "target": {target}})
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode <= 299:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return false, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+}
+
+// discoverWebmentionEndpoint 按规范查找接收端点：先看 HTTP Link 头，再看页面中第一个
+// rel="webmention" 的 <link> 或 <a>，相对地址按最终（跳转后的）地址解析
+func discoverWebmentionEndpoint(target string) (string, error) {
+	resp, err := webmentionClient().Get(target)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		return "", fmt.Errorf("target returned %d", resp.StatusCode)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return "", errNoWebmentionEndpoint
+	}
+
+	href, found := "", false
+	for _, header := range resp.Header.Values("Link") {
+		if href, found = webmentionFromLinkHeader(header); found {
+			break
+		}
+	}
+	if !found && strings.Contains(resp.Header.Get("Content-Type"), "html") {
+		doc, err := html.Parse(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return "", err
+		}
+		walkHTML(doc, func(n *html.Node) {
+			if found || n.Type != html.ElementNode || (n.Data != "link" && n.Data != "a") {
+				return
+			}
+			rel, _ := htmlAttr(n, "rel")
+			if v, ok := htmlAttr(n, "href"); ok && hasRel(rel, "webmention") {
+				href, found = v, true
+			}
+		})
+	}
+	if !found {
+		return "", errNoWebmentionEndpoint
+	}
+
+	u, err := url.Parse(href)
+	if err != nil {
+		return "", errNoWebmentionEndpoint
+	}
+	endpoint := resp.Request.URL.ResolveReference(u)
+	if !isHTTPURL(endpoint) {
+		return "", errNoWebmentionEndpoint
+	}
+	return endpoint.String(), nil
+}
+
+// webmentionFromLinkHeader 解析 Link: <https://example.com/wm>; rel="webmention"
+func webmentionFromLinkHeader(header string) (string, bool) {
+	for _, part := range strings.Split(header, ",") {
+		segments := strings.Split(part, ";")
+		link := strings.TrimSpace(segments[0])
+		if !strings.HasPrefix(link, "<") || !strings.HasSuffix(link, ">") {
+			continue
+		}
+		for _, param := range segments[1:] {
+			key, value, ok := strings.Cut(strings.TrimSpace(param), "=")
+			if ok && strings.EqualFold(strings.TrimSpace(key), "rel") && hasRel(strings.Trim(value, `"`), "webmention") {
+				return link[1 : len(link)-1], true
+			}
+		}
+	}
+	return "", false
+}
+
+func hasRel(rel, want string) bool {
+	for _, r := range strings.Fields(rel) {
+		if strings.EqualFold(r, want) {
+			return true
+		}
+	}
+	return false
+}
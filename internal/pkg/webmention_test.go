@@ -0,0 +1,178 @@
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func setupWebmention(t *testing.T) {
+	t.Helper()
+	setupTestDir(t)
+	AppConfig.Site.BaseURL = "https://blog.example.com"
+	AppConfig.Webmention = WebmentionConfig{Enabled: true, AllowPrivate: true}
+	AppConfig.Comments.Moderation = ""
+	webmentions = nil
+	verifyQueue = make(chan webmentionRequest, 1)
+
+	writeTestPost(t, "tech", "hello", "id: 01HELLO\ntitle: Hello\ndate: 2026-01-01", "正文")
+	loadTestPosts(t)
+}
+
+// receive 调用 ReceiveWebmention 并同步执行排队的校验
+func receive(t *testing.T, source, target string) error {
+	t.Helper()
+	if err := ReceiveWebmention(source, target, "blog.example.com"); err != nil {
+		return err
+	}
+	return verifyWebmention(<-verifyQueue)
+}
+
+func TestReceiveWebmention(t *testing.T) {
+	setupWebmention(t)
+	target := "https://blog.example.com/tech/hello.html"
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		switch r.URL.Path {
+		case "/linked":
+			fmt.Fprintf(w, `<div class="h-entry"><p class="p-name">回应</p>
+				<a class="p-author h-card" href="https://alice.example">Alice</a>
+				<a class="u-in-reply-to" href="%s">原文</a></div>`, target)
+		case "/unlinked":
+			fmt.Fprint(w, `<p>这里没有链接到 <a href="https://blog.example.com/tech/other.html">目标</a></p>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer source.Close()
+
+	if err := receive(t, source.URL+"/linked", target); err != nil {
+		t.Fatalf("linked source rejected: %v", err)
+	}
+	got := GetWebmentionsByPost("01HELLO")
+	if len(got) != 1 {
+		t.Fatalf("got %d webmentions, want 1", len(got))
+	}
+	if got[0].Type != WebmentionReply || got[0].Author != "Alice" {
+		t.Errorf("parsed mention = %+v", got[0])
+	}
+
+	if err := receive(t, source.URL+"/unlinked", target); err == nil {
+		t.Error("source without a link to the target was accepted")
+	}
+	if n := len(GetAllWebmentions()); n != 1 {
+		t.Errorf("stored %d webmentions, want 1", n)
+	}
+
+	if err := ReceiveWebmention(source.URL+"/linked", "https://other.example/tech/hello.html", "blog.example.com"); !errors.Is(err, ErrWebmentionTarget) {
+		t.Errorf("foreign target: err = %v", err)
+	}
+}
+
+func TestWebmentionRefusesPrivateAddress(t *testing.T) {
+	setupWebmention(t)
+	AppConfig.Webmention.AllowPrivate = false
+
+	source := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer source.Close()
+
+	err := receive(t, source.URL, "https://blog.example.com/tech/hello.html")
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("err = %v, want %v", err, errPrivateAddress)
+	}
+}
+
+func TestCheckDialAddress(t *testing.T) {
+	setupTestDir(t)
+
+	tests := []struct {
+		address string
+		blocked bool
+	}{
+		{"93.184.216.34:443", false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false},
+		{"100.63.255.255:80", false},
+		{"127.0.0.1:80", true},
+		{"10.1.2.3:80", true},
+		{"192.168.1.1:80", true},
+		{"169.254.169.254:80", true}, // 云主机元数据
+		{"100.64.0.1:80", true},      // CGNAT
+		{"100.127.255.254:80", true},
+		{"0.0.0.0:80", true},
+		{"224.0.0.1:80", true},
+		{"[::1]:80", true},
+		{"[fe80::1%eth0]:80", true},
+		{"[ff02::1]:80", true}, // 链路本地组播
+		{"[fd00::1]:80", true},
+		{"[::ffff:127.0.0.1]:80", true}, // IPv4 映射地址
+		{"[::ffff:10.0.0.1]:80", true},
+		{"[::ffff:100.64.0.1]:80", true},
+		{"[::ffff:93.184.216.34]:443", false},
+	}
+	for _, tt := range tests {
+		err := checkDialAddress("tcp", tt.address, nil)
+		if blocked := errors.Is(err, errPrivateAddress); blocked != tt.blocked {
+			t.Errorf("checkDialAddress(%s) = %v, want blocked=%v", tt.address, err, tt.blocked)
+		}
+	}
+
+	AppConfig.Webmention.AllowPrivate = true
+	if err := checkDialAddress("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("allow_private: got %v", err)
+	}
+}
+
+func TestDiscoverWebmentionEndpoint(t *testing.T) {
+	setupTestDir(t)
+	AppConfig.Webmention.AllowPrivate = true
+
+	var received url.Values
+	mux := http.NewServeMux()
+	mux.HandleFunc("/header", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", `<https://example.com/style.css>; rel="stylesheet"`)
+		w.Header().Add("Link", `</endpoint?via=header>; rel="webmention"`)
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<link rel="webmention" href="/wrong">`)
+	})
+	mux.HandleFunc("/html/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="stylesheet" href="/s.css"><link rel="webmention" href="../endpoint?via=html"></head></html>`)
+	})
+	mux.HandleFunc("/none", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<p>no endpoint</p>`)
+	})
+	mux.HandleFunc("/endpoint", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		received = r.PostForm
+		w.WriteHeader(http.StatusAccepted)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	cases := map[string]string{
+		"/header":    server.URL + "/endpoint?via=header",
+		"/html/page": server.URL + "/endpoint?via=html",
+	}
+	for path, want := range cases {
+		got, err := discoverWebmentionEndpoint(server.URL + path)
+		if err != nil || got != want {
+			t.Errorf("%s: endpoint = %q, %v; want %q", path, got, err, want)
+		}
+	}
+	if _, err := discoverWebmentionEndpoint(server.URL + "/none"); !errors.Is(err, errNoWebmentionEndpoint) {
+		t.Errorf("/none: err = %v", err)
+	}
+
+	source := "https://blog.example.com/tech/hello.html"
+	if retry, err := sendWebmention(source, server.URL+"/html/page"); err != nil || retry {
+		t.Fatalf("send: retry=%v err=%v", retry, err)
+	}
+	if received.Get("source") != source || received.Get("target") != server.URL+"/html/page" {
+		t.Errorf("endpoint received %v", received)
+	}
+}
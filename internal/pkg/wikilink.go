@@ -0,0 +1,213 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Wiki 链接：[[slug]]、[[category/slug]]、[[slug|文字]]、[[category/slug#heading-1|文字]]
+//
+// Markdown 渲染时各文章尚未全部载入，因此渲染器先输出占位标签，
+// 由 resolveWikiLinks 在全部文章载入后替换为真实链接。
+
+var wikiLinksKey = parser.NewContextKey()
+
+// KindWikiLink Wiki 链接节点
+var KindWikiLink = ast.NewNodeKind("WikiLink")
+
+// WikiLink [[target|label]]
+type WikiLink struct {
+	ast.BaseInline
+	Target string
+	Label  string
+}
+
+func (n *WikiLink) Kind() ast.NodeKind { return KindWikiLink }
+
+func (n *WikiLink) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Target": n.Target, "Label": n.Label}, nil)
+}
+
+type wikiLinkParser struct{}
+
+func (p *wikiLinkParser) Trigger() []byte {
+	return []byte{'['}
+}
+
+func (p *wikiLinkParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, _ := block.PeekLine()
+	if !bytes.HasPrefix(line, []byte("[[")) {
+		return nil
+	}
+	end := bytes.Index(line, []byte("]]"))
+	if end < 3 {
+		return nil
+	}
+	inner := string(line[2:end])
+	if strings.ContainsAny(inner, "[]\n") {
+		return nil
+	}
+
+	target, label := inner, ""
+	if i := strings.Index(inner, "|"); i >= 0 {
+		target, label = inner[:i], strings.TrimSpace(inner[i+1:])
+	}
+	target = strings.TrimSpace(target)
+	if target == "" {
+		return nil
+	}
+
+	block.Advance(end + 2)
+	targets, _ := pc.Get(wikiLinksKey).([]string)
+	pc.Set(wikiLinksKey, append(targets, target))
+	return &WikiLink{Target: target, Label: label}
+}
+
+type wikiLinkRenderer struct{}
+
+func (r *wikiLinkRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(KindWikiLink, r.renderWikiLink)
+}
+
+func (r *wikiLinkRenderer) renderWikiLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*WikiLink)
+	label, auto := n.Label, ""
+	if label == "" {
+		label, auto = n.Target, " data-wikilink-auto"
+	}
+	fmt.Fprintf(w, `<a class="wikilink" href="#" data-wikilink="%s"%s>%s</a>`,
+		html.EscapeString(n.Target), auto, html.EscapeString(label))
+	return ast.WalkSkipChildren, nil
+}
+
+type wikiLinkExtension struct{}
+
+func (e *wikiLinkExtension) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithInlineParsers(
+		util.Prioritized(&wikiLinkParser{}, 199), // 先于普通链接解析
+	))
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(
+		util.Prioritized(&wikiLinkRenderer{}, 500),
+	))
+}
+
+// wikiLinkTargets 读取解析过程中收集到的 Wiki 链接目标
+func wikiLinkTargets(pc parser.Context) []string {
+	targets, _ := pc.Get(wikiLinksKey).([]string)
+	return targets
+}
+
+var wikiPlaceholderPattern = regexp.MustCompile(`<a class="wikilink" href="#" data-wikilink="([^"]*)"( data-wikilink-auto)?>([^<]*)</a>`)
+
+// lookupWikiTarget 按 category/slug 或 slug 查找文章，返回文章和锚点
+func lookupWikiTarget(target string, postsMap map[string]*Post) (*Post, string) {
+	fragment := ""
+	if i := strings.Index(target, "#"); i >= 0 {
+		target, fragment = target[:i], target[i:]
+	}
+	target = strings.ToLower(strings.TrimSuffix(strings.Trim(target, "/"), ".md"))
+	target = strings.TrimSuffix(target, ".html")
+
+	if strings.Contains(target, "/") {
+		return postsMap[target], fragment
+	}
+
+	// 只有 slug 时在所有分类中查找，重名时按 category/slug 排序取第一个并提示
+	var keys []string
+	for key, post := range postsMap {
+		if strings.ToLower(post.Slug) == target {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fragment
+	}
+	sort.Strings(keys)
+	if len(keys) > 1 {
+		slog.Warn("ambiguous wiki link", "target", target, "using", keys[0], "candidates", strings.Join(keys, ", "))
+	}
+	return postsMap[keys[0]], fragment
+}
+
+// resolveWikiLinks 将占位标签替换为文章链接，返回替换后的 HTML 和无法解析的目标
+func resolveWikiLinks(content string, postsMap map[string]*Post) (string, []string) {
+	var unresolved []string
+	result := wikiPlaceholderPattern.ReplaceAllStringFunc(content, func(match string) string {
+		m := wikiPlaceholderPattern.FindStringSubmatch(match)
+		target := html.UnescapeString(m[1])
+		label := m[3]
+
+		post, fragment := lookupWikiTarget(target, postsMap)
+		if post == nil {
+			unresolved = append(unresolved, target)
+			return fmt.Sprintf(`<a class="wikilink wikilink-missing" title="未找到：%s">%s</a>`, m[1], label)
+		}
+		if m[2] != "" {
+			label = html.EscapeString(post.Title)
+		}
+		return fmt.Sprintf(`<a class="wikilink" href="/%s/%s.html%s">%s</a>`,
+			post.Category, post.Slug, html.EscapeString(fragment), label)
+	})
+	return result, unresolved
+}
+
+// ResolveWikiLinks 使用当前已载入的文章解析 Wiki 链接（用于缓存重建和预览）
+func ResolveWikiLinks(content string) string {
+	result, _ := resolveWikiLinks(content, currentSnapshot().byKey)
+	return result
+}
+
+// buildBacklinks 根据文章中的站内链接（包括已解析的 Wiki 链接）计算反向链接，只在构建快照时调用
+func buildBacklinks(posts map[string]*Post) {
+	for _, post := range posts {
+		post.Backlinks = nil
+	}
+
+	for _, source := range posts {
+		if source.Draft {
+			continue
+		}
+		seen := make(map[*Post]bool)
+		addBacklink := func(target *Post) {
+			if target == nil || target == source || seen[target] {
+				return
+			}
+			seen[target] = true
+			target.Backlinks = append(target.Backlinks, source)
+		}
+
+		for _, m := range linkAttrPattern.FindAllStringSubmatch(source.Content, -1) {
+			if m[2] != "href" {
+				continue
+			}
+			href := m[3]
+			if i := strings.IndexAny(href, "?#"); i >= 0 {
+				href = href[:i]
+			}
+			if sm := postLinkPattern.FindStringSubmatch(href); sm != nil {
+				addBacklink(posts[strings.ToLower(sm[1]+"/"+sm[2])])
+			}
+		}
+	}
+
+	for _, post := range posts {
+		sort.Slice(post.Backlinks, func(i, j int) bool {
+			return post.Backlinks[i].Date.After(post.Backlinks[j].Date)
+		})
+	}
+}
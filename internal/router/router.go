@@ -3,13 +3,16 @@ package router
 import (
 	"archive/zip"
 	"crypto/rand"
+	"crypto/subtle"
 	"encoding/hex"
 	"encoding/xml"
 	"fmt"
 	"io"
+	"log/slog"
 	"mdblog/internal/pkg"
 	"mdblog/internal/theme"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -62,6 +65,184 @@ func deleteSession(sessionID string) {
 	delete(sessions, sessionID)
 }
 
+// isAdminRequest 请求是否来自已登录的管理员
+func isAdminRequest(c *gin.Context) bool {
+	sessionID, err := c.Cookie("admin_session")
+	return err == nil && isValidSession(sessionID)
+}
+
+// StatsAPIAuth 统计接口认证：Authorization: Bearer <stats.api_token>，或已登录的管理员
+func StatsAPIAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		expected := pkg.AppConfig.Stats.APIToken
+		if expected != "" && subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1 {
+			c.Next()
+			return
+		}
+		if isAdminRequest(c) {
+			c.Next()
+			return
+		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, Response{Code: 401, Message: "未授权", Data: nil})
+	}
+}
+
+// RequestIDMiddleware 为每个请求分配 ID（沿用上游代理传入的合法 X-Request-ID），
+// 写入响应头和请求 context，处理函数用 slog.*Context 记录的日志会带上它
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !validRequestID(id) {
+			id = pkg.NewULID()
+		}
+		c.Header("X-Request-ID", id)
+		c.Request = c.Request.WithContext(pkg.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogger 用 slog 记录访问日志，替代 gin 默认的 Logger
+func RequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			slog.Duration("latency", time.Since(start)),
+			slog.String("ip", c.ClientIP()),
+			slog.Int("size", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("errors", c.Errors.String()))
+		}
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// HealthCheck 单项检查结果
+type HealthCheck struct {
+	Status string `json:"status"` // ok 或 fail
+	Error  string `json:"error,omitempty"`
+}
+
+// ReadinessResponse 就绪检查结果，任一项失败时 Status 为 fail
+type ReadinessResponse struct {
+	Status    string                 `json:"status"`
+	Checks    map[string]HealthCheck `json:"checks"`
+	Content   pkg.ContentStatus      `json:"content"`
+	CheckedAt time.Time              `json:"checked_at"`
+}
+
+func healthLive(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+func healthReady(c *gin.Context) {
+	content := pkg.GetContentStatus()
+	resp := ReadinessResponse{Status: "ok", Checks: make(map[string]HealthCheck), Content: content, CheckedAt: time.Now()}
+
+	// 探针接口不需要登录，只输出笼统的原因，具体错误（含文件路径）见日志。reason 为空表示通过
+	check := func(name, reason string) {
+		if reason != "" {
+			resp.Checks[name] = HealthCheck{Status: "fail", Error: reason}
+			resp.Status = "fail"
+			return
+		}
+		resp.Checks[name] = HealthCheck{Status: "ok"}
+	}
+	var contentReason string
+	switch {
+	case !content.Ready:
+		contentReason = "内容和搜索索引尚未加载完成"
+	case content.LastError != "":
+		contentReason = "最近一次载入失败"
+	}
+	check("content", contentReason)
+
+	var dataReason string
+	if err := pkg.CheckDataWritable(); err != nil {
+		slog.WarnContext(c.Request.Context(), "health check: data directory not writable", "err", err)
+		dataReason = "data 目录不可写"
+	}
+	check("data_dir", dataReason)
+
+	var templatesReason string
+	if err := theme.CheckTemplates(); err != nil {
+		templatesReason = "模板未加载或编译失败"
+	}
+	check("templates", templatesReason)
+
+	status := http.StatusOK
+	if resp.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(status, resp)
+}
+
+// MetricsMiddleware 按路由模板记录请求数和耗时，未匹配的路由统一记为 unmatched，避免标签数量失控
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		pkg.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
+
+// MetricsHandler 以 Prometheus 文本格式输出指标
+func MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	pkg.WriteMetrics(w)
+}
+
+// metricsAuth 主端口 /metrics 的认证：Authorization: Bearer <metrics.token>
+func metricsAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		expected := pkg.AppConfig.Metrics.Token
+		if expected == "" || subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		c.Next()
+	}
+}
+
+// invalidatePageCacheOnWrite 后台的修改操作（非 GET 请求）可能影响任何前台页面，处理后清空整页缓存
+func invalidatePageCacheOnWrite() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if c.Request.Method != http.MethodGet {
+			pkg.InvalidatePageCache()
+		}
+	}
+}
+
 // Admin 认证中间件
 func AdminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -76,7 +257,17 @@ func AdminAuthMiddleware() gin.HandlerFunc {
 }
 
 func SetupRouter() *gin.Engine {
-	r := gin.Default()
+	r := gin.New()
+	r.Use(RequestIDMiddleware(), RequestLogger(), gin.Recovery())
+
+	// Prometheus 指标：设置了单独的监听地址时由 main 在该地址提供，否则在主端口凭令牌访问
+	metrics := pkg.AppConfig.Metrics
+	if metrics.Enabled {
+		r.Use(MetricsMiddleware())
+		if metrics.Listen == "" && metrics.Token != "" {
+			r.GET("/metrics", metricsAuth(), gin.WrapF(MetricsHandler))
+		}
+	}
 
 	// Gzip 压缩
 	r.Use(gzip.Gzip(gzip.DefaultCompression))
@@ -108,11 +299,17 @@ func SetupRouter() *gin.Engine {
 
 	// Static files with cache
 	staticGroup := r.Group("/static", staticCacheMiddleware)
-	staticGroup.Static("/", filepath.Join("themes", pkg.AppConfig.Theme, "static"))
+	staticGroup.GET("/*filepath", theme.ServeStatic)
+	staticGroup.HEAD("/*filepath", theme.ServeStatic)
+	resizedGroup := r.Group(strings.TrimSuffix(pkg.ResizedURLPrefix, "/"), staticCacheMiddleware)
+	resizedGroup.Static("/", pkg.ImageCacheDir())
 	r.Static("/admin-static", "admin/static")
 
 	// Frontend routes
 	r.GET("/", func(c *gin.Context) {
+		if theme.ServeCachedPage(c) {
+			return
+		}
 		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
 		if page < 1 {
 			page = 1
@@ -130,40 +327,32 @@ func SetupRouter() *gin.Engine {
 	})
 
 	r.GET("/categories", func(c *gin.Context) {
-		cats, _ := pkg.ListCategories()
-		sort.Slice(cats, func(i, j int) bool {
-			return cats[i].Name < cats[j].Name
-		})
+		if theme.ServeCachedPage(c) {
+			return
+		}
 		theme.Render(c, "categories.html", gin.H{
-			"Categories": cats,
+			"Categories": pkg.CachedCategories(),
 		})
 	})
 
 	r.GET("/category/:name", func(c *gin.Context) {
-		name := c.Param("name")
-		var posts []*pkg.Post
-		for _, p := range pkg.Posts {
-			if p.Category == name {
-				posts = append(posts, p)
-			}
+		if theme.ServeCachedPage(c) {
+			return
 		}
-		sort.Slice(posts, func(i, j int) bool {
-			if posts[i].Pinned != posts[j].Pinned {
-				return posts[i].Pinned
-			}
-			return posts[i].Date.After(posts[j].Date)
-		})
-
+		name := c.Param("name")
 		theme.Render(c, "category.html", gin.H{
 			"Category": name,
-			"Posts":    posts,
+			"Posts":    pkg.GetPostsByCategory(name),
 		})
 	})
 
 	// Tags routes
 	r.GET("/tags", func(c *gin.Context) {
+		if theme.ServeCachedPage(c) {
+			return
+		}
 		tags := pkg.ListTags()
-		sort.Slice(tags, func(i, j int) bool {
+		sort.SliceStable(tags, func(i, j int) bool {
 			return tags[i].PostCount > tags[j].PostCount // 按文章数降序
 		})
 		theme.Render(c, "tags.html", gin.H{
@@ -172,6 +361,9 @@ func SetupRouter() *gin.Engine {
 	})
 
 	r.GET("/tag/:name", func(c *gin.Context) {
+		if theme.ServeCachedPage(c) {
+			return
+		}
 		name := c.Param("name")
 		posts := pkg.GetPostsByTag(name)
 		sort.Slice(posts, func(i, j int) bool {
@@ -191,9 +383,8 @@ func SetupRouter() *gin.Engine {
 		slug := strings.TrimPrefix(path, "/")
 		slug = strings.TrimSuffix(slug, ".html")
 
-		pages, _ := pkg.ListPages()
 		var foundPage *pkg.Page
-		for _, p := range pages {
+		for _, p := range pkg.CachedPages() {
 			if p.Slug == slug {
 				foundPage = &p
 				break
@@ -204,13 +395,16 @@ func SetupRouter() *gin.Engine {
 			theme.Render(c, "404.html", gin.H{})
 			return
 		}
+		if theme.ServeCachedPage(c) {
+			return
+		}
 
 		post, err := pkg.ParseMarkdownFile(foundPage.FilePath)
 		if err != nil {
 			theme.Render(c, "404.html", gin.H{})
 			return
 		}
-		theme.Render(c, "page.html", gin.H{
+		theme.Render(c, pkg.ResolveLayout(post.Layout, "page.html"), gin.H{
 			"Post":    post,
 			"Content": post.Content,
 		})
@@ -225,33 +419,47 @@ func SetupRouter() *gin.Engine {
 		slug := strings.TrimPrefix(path, "/")
 		slug = strings.TrimSuffix(slug, ".html")
 
-		// 构造 key 并查询
-		key := strings.ToLower(category + "/" + slug)
-		post, ok := pkg.PostsMap[key]
-
-		if !ok {
-			// 增加调试信息
-			fmt.Printf("[DEBUG] 404 access: RequestPath=%s, ParsedKey=%s\n", c.Request.URL.Path, key)
-			// fmt.Println("Available keys in PostsMap:")
-			// for k := range pkg.PostsMap {
-			// 	fmt.Println(" - ", k)
-			// }
+		post := pkg.GetPost(category, slug)
+		if post == nil {
+			slog.DebugContext(c.Request.Context(), "post not found", "path", c.Request.URL.Path, "category", category, "slug", slug)
 			theme.Render(c, "404.html", gin.H{})
 			return
 		}
 
+		// 记录访问，已登录的管理员预览不计入
+		if !isAdminRequest(c) {
+			pkg.RecordView(post.ID, pkg.Visit{
+				IP:        c.ClientIP(),
+				UserAgent: c.Request.UserAgent(),
+				Referrer:  c.Request.Referer(),
+				UTMSource: c.Query("utm_source"),
+				Host:      c.Request.Host,
+			})
+		}
+		if pkg.AppConfig.Webmention.Enabled {
+			c.Header("Link", `</webmention>; rel="webmention"`)
+		}
+		if theme.ServeCachedPage(c) {
+			return
+		}
+
 		content := pkg.GetCachedContent(post)
-		pkg.RecordView(post.Slug) // 记录访问
 		prev, next := pkg.GetAdjacentPosts(post)
 		related := pkg.GetRelatedPosts(post, 3)
-		comments := pkg.GetCommentsByPost(post.Slug)
-		theme.Render(c, "post.html", gin.H{
+		commentPage, _ := strconv.Atoi(c.DefaultQuery("cpage", "1"))
+		comments := pkg.GetCommentPage(post.ID, commentPage, c.Query("comment_sort"))
+		theme.Render(c, pkg.ResolveLayout(post.Layout, "post.html"), gin.H{
 			"Post":         post,
 			"Content":      content,
 			"PrevPost":     prev,
 			"NextPost":     next,
 			"RelatedPosts": related,
-			"Comments":     comments,
+			"CommentPage":  comments,
+			"CommentToken": pkg.CommentTokenPlaceholder,
+			"CommentPoW":   pkg.PoWEnabled(),
+			"MyComments":   pkg.EditableComments(commentEditTokens(c)),
+			"Webmention":   pkg.AppConfig.Webmention.Enabled,
+			"Webmentions":  pkg.GetWebmentionsByPost(post.ID),
 		})
 	})
 
@@ -266,16 +474,35 @@ func SetupRouter() *gin.Engine {
 
 	// RSS Feed
 	r.GET("/feed.xml", func(c *gin.Context) {
-		c.Header("Content-Type", "application/rss+xml; charset=utf-8")
-		feed := generateRSSFeed()
-		c.String(http.StatusOK, feed)
+		feed := []byte(generateRSSFeed())
+		theme.ServeConditional(c, "application/rss+xml; charset=utf-8", theme.ETag(feed), pkg.ContentLastModified(), feed)
 	})
 
+	// 评论 Feed，?post=<文章 ID> 只输出该文章的评论
+	commentFeed := func(atom bool) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			var post *pkg.Post
+			if id := c.Query("post"); id != "" {
+				if post = pkg.GetPostByID(id); post == nil {
+					c.String(http.StatusNotFound, "Post not found")
+					return
+				}
+			}
+			if atom {
+				c.Header("Content-Type", "application/atom+xml; charset=utf-8")
+			} else {
+				c.Header("Content-Type", "application/rss+xml; charset=utf-8")
+			}
+			c.String(http.StatusOK, generateCommentFeed(post, atom))
+		}
+	}
+	r.GET("/comments/feed.xml", commentFeed(false))
+	r.GET("/comments/atom.xml", commentFeed(true))
+
 	// Sitemap
 	r.GET("/sitemap.xml", func(c *gin.Context) {
-		c.Header("Content-Type", "application/xml; charset=utf-8")
-		sitemap := generateSitemap()
-		c.String(http.StatusOK, sitemap)
+		sitemap := []byte(generateSitemap())
+		theme.ServeConditional(c, "application/xml; charset=utf-8", theme.ETag(sitemap), pkg.ContentLastModified(), sitemap)
 	})
 
 	// Robots.txt
@@ -284,14 +511,11 @@ func SetupRouter() *gin.Engine {
 		c.String(http.StatusOK, robots)
 	})
 
-	// Health Check
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status":     "ok",
-			"posts":      len(pkg.Posts),
-			"categories": len(pkg.PostsMap),
-		})
-	})
+	// 健康检查：/health/live 只表示进程存活，/health/ready 检查内容、data 目录和模板，
+	// 未就绪时返回 503，供容器编排的存活和就绪探针使用。/health 保留为存活检查
+	r.GET("/health", healthLive)
+	r.GET("/health/live", healthLive)
+	r.GET("/health/ready", healthReady)
 
 	// ========== 示例 API（青峰 Swagger 演示）==========
 	api := r.Group("/api")
@@ -300,11 +524,22 @@ func SetupRouter() *gin.Engine {
 		api.GET("/posts/:id", getPostByID)
 		api.GET("/categories", getCategories)
 		api.GET("/info", getInfo)
+		api.GET("/stats", StatsAPIAuth(), getStats)
 	}
 
+	// 评论工作量证明题目
+	r.GET("/comment/challenge", func(c *gin.Context) {
+		c.Header("Cache-Control", "no-store")
+		if !pkg.PoWEnabled() {
+			c.JSON(http.StatusOK, gin.H{"enabled": false})
+			return
+		}
+		c.JSON(http.StatusOK, pkg.NewPoWChallenge())
+	})
+
 	// Comment submission
 	r.POST("/comment", func(c *gin.Context) {
-		postSlug := c.PostForm("post_slug")
+		postID := c.PostForm("post_id")
 		author := c.PostForm("author")
 		email := c.PostForm("email")
 		content := c.PostForm("content")
@@ -312,7 +547,7 @@ func SetupRouter() *gin.Engine {
 		replyTo := c.PostForm("reply_to")
 
 		// 简单验证
-		if postSlug == "" || author == "" || content == "" {
+		if postID == "" || author == "" || content == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "缺少必填字段"})
 			return
 		}
@@ -321,19 +556,134 @@ func SetupRouter() *gin.Engine {
 			return
 		}
 
-		_, err := pkg.AddComment(postSlug, author, email, content, parentID, replyTo)
+		// 蜜罐字段：正常用户看不到，机器人填写后假装成功
+		if c.PostForm("website") != "" {
+			c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "评论成功"})
+			return
+		}
+		if err := pkg.CheckCommentFormToken(c.PostForm("token")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if pkg.PoWEnabled() {
+			if err := pkg.VerifyPoW(c.PostForm("pow_challenge"), c.PostForm("pow_nonce")); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		ip := c.ClientIP()
+		if pkg.IsCommentBanned(ip, email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": pkg.ErrCommentBanned.Error()})
+			return
+		}
+		if !pkg.AllowCommentFrom(ip) {
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": pkg.ErrCommentRateLimit.Error()})
+			return
+		}
+
+		post := pkg.GetPostByID(postID)
+		if post == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "文章不存在"})
+			return
+		}
+		comment, editToken, err := pkg.AddComment(post, author, email, content, parentID, replyTo, ip)
 		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to save comment", "post", post.ID, "err", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
 			return
 		}
+		rememberCommentEditToken(c, comment.ID, editToken)
 
+		if !comment.Approved {
+			c.JSON(http.StatusOK, gin.H{"status": "pending", "message": "评论已提交，审核通过后显示"})
+			return
+		}
 		c.JSON(http.StatusOK, gin.H{"status": "ok", "message": "评论成功"})
 	})
 
+	// 评论者在时限内修改、删除自己的评论，令牌从 Cookie 读取
+	r.POST("/comment/edit", func(c *gin.Context) {
+		id := c.PostForm("id")
+		content := strings.TrimSpace(c.PostForm("content"))
+		if content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论内容不能为空"})
+			return
+		}
+		if len(content) > 2000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论内容过长"})
+			return
+		}
+		comment, err := pkg.EditOwnComment(id, commentEditTokens(c)[id], content)
+		if err != nil {
+			c.JSON(commentEditStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !comment.Approved {
+			c.JSON(http.StatusOK, gin.H{"status": "pending", "message": "修改已提交，审核通过后显示"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "html": comment.ContentHTML})
+	})
+
+	r.POST("/comment/delete", func(c *gin.Context) {
+		id := c.PostForm("id")
+		if err := pkg.DeleteOwnComment(id, commentEditTokens(c)[id]); err != nil {
+			c.JSON(commentEditStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// 评论 Markdown 预览
+	r.POST("/comment/preview", func(c *gin.Context) {
+		content := c.PostForm("content")
+		if len(content) > 2000 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论内容过长"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "html": pkg.RenderCommentMarkdown(content)})
+	})
+
+	// Webmention 接收端点：参数校验通过即返回 202，来源页面在后台异步校验
+	r.POST("/webmention", func(c *gin.Context) {
+		if !pkg.AppConfig.Webmention.Enabled {
+			c.String(http.StatusNotFound, "webmention is disabled")
+			return
+		}
+		if !pkg.AllowWebmentionFrom(c.ClientIP()) {
+			c.String(http.StatusTooManyRequests, "Too many requests")
+			return
+		}
+		err := pkg.ReceiveWebmention(c.PostForm("source"), c.PostForm("target"), c.Request.Host)
+		switch err {
+		case nil:
+			c.String(http.StatusAccepted, "Accepted")
+		case pkg.ErrWebmentionQueue:
+			c.String(http.StatusServiceUnavailable, err.Error())
+		default:
+			c.String(http.StatusBadRequest, err.Error())
+		}
+	})
+
+	// 退订评论回复通知
+	r.GET("/comment/unsubscribe", func(c *gin.Context) {
+		email := c.Query("email")
+		if !pkg.CheckUnsubscribeToken(email, c.Query("token")) {
+			c.String(http.StatusBadRequest, "退订链接无效")
+			return
+		}
+		if err := pkg.Unsubscribe(email); err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to unsubscribe", "err", err)
+			c.String(http.StatusInternalServerError, "退订失败，请稍后重试")
+			return
+		}
+		c.String(http.StatusOK, "已退订，%s 将不再收到评论回复通知。", email)
+	})
+
 	// Admin login page
 	r.GET("/admin/login", func(c *gin.Context) {
 		// 已登录则跳转
-		if sessionID, err := c.Cookie("admin_session"); err == nil && isValidSession(sessionID) {
+		if isAdminRequest(c) {
 			c.Redirect(http.StatusFound, "/admin/")
 			return
 		}
@@ -489,16 +839,25 @@ func SetupRouter() *gin.Engine {
 	})
 
 	// Admin routes (protected)
-	admin := r.Group("/admin", AdminAuthMiddleware())
+	admin := r.Group("/admin", AdminAuthMiddleware(), invalidatePageCacheOnWrite())
 
 	admin.GET("/", func(c *gin.Context) {
 		cats, _ := pkg.ListCategories()
 		pages, _ := pkg.ListPages()
 		stats := pkg.GetStats()
-		chartLabels, chartValues := pkg.GetDailyViewsChart()
+		chartDays, _ := strconv.Atoi(c.DefaultQuery("days", "30"))
+		switch chartDays {
+		case 7, 30, 90, 365:
+		default:
+			chartDays = 30
+		}
+		chartLabels, chartValues, chartVisitors := pkg.GetDailyViewsChart(chartDays)
+		now := time.Now()
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		rangeStart := now.AddDate(0, 0, 1-chartDays)
 		pendingComments := pkg.GetPendingComments()
 
-		recentPosts := pkg.Posts
+		recentPosts := pkg.PublishedPosts()
 		if len(recentPosts) > 5 {
 			recentPosts = recentPosts[:5]
 		}
@@ -507,10 +866,18 @@ func SetupRouter() *gin.Engine {
 			"RecentPosts":     recentPosts,
 			"Categories":      cats,
 			"Pages":           pages,
-			"PostCount":       len(pkg.Posts),
+			"PostCount":       len(pkg.PublishedPosts()),
 			"Stats":           stats,
+			"ChartDays":       chartDays,
 			"ChartLabels":     chartLabels,
 			"ChartValues":     chartValues,
+			"ChartVisitors":   chartVisitors,
+			"TodayVisitors":   pkg.GetTodayVisitors(),
+			"TopReferrers":    pkg.GetTopReferrersSince(rangeStart, 10),
+			"TopUTMSources":   pkg.GetTopUTMSourcesSince(rangeStart, 10),
+			"ExportFrom":      rangeStart.Format("2006-01-02"),
+			"ExportTo":        now.Format("2006-01-02"),
+			"MonthTopPosts":   pkg.GetTopPostsSince(monthStart, 10),
 			"PendingComments": len(pendingComments),
 			"Tab":             "overview",
 		})
@@ -519,6 +886,29 @@ func SetupRouter() *gin.Engine {
 		}
 	})
 
+	// 导出访问统计：format=csv|json，by=day|post，from/to 为 YYYY-MM-DD
+	admin.GET("/stats/export", func(c *gin.Context) {
+		from, to, err := pkg.ParseStatsRange(c.Query("from"), c.Query("to"))
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		format := c.DefaultQuery("format", pkg.StatsFormatCSV)
+		by := c.DefaultQuery("by", pkg.StatsByDay)
+		data, err := pkg.ExportStats(pkg.GetStatsReport(from, to), format, by)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		filename := fmt.Sprintf("stats-%s-%s_%s.%s", by, from.Format("20060102"), to.Format("20060102"), format)
+		c.Header("Content-Disposition", "attachment; filename="+filename)
+		contentType := "text/csv; charset=utf-8"
+		if format == pkg.StatsFormatJSON {
+			contentType = "application/json; charset=utf-8"
+		}
+		c.Data(http.StatusOK, contentType, data)
+	})
+
 	// New Route: Manage Posts
 	admin.GET("/posts", func(c *gin.Context) {
 		cats, _ := pkg.ListCategories()
@@ -711,9 +1101,13 @@ func SetupRouter() *gin.Engine {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
+		if err := pkg.EnsurePostID(path); err != nil {
+			slog.ErrorContext(c.Request.Context(), "failed to assign post id", "path", path, "err", err)
+		}
 		pkg.InvalidateCache(path)
 		pkg.LoadAllPosts()
 		pkg.InitSearchIndex()
+		go pkg.SendWebmentions(pkg.GetPostByFilePath(path))
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
@@ -727,6 +1121,11 @@ func SetupRouter() *gin.Engine {
 			return
 		}
 		
+		// 暂用 category/slug 作为 ID 的文章移动后 ID 会变，先写入固定 ID
+		if err := pkg.EnsurePostID(path); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
 		newPath, err := pkg.MovePostToCategory(path, category)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -757,6 +1156,7 @@ func SetupRouter() *gin.Engine {
 		pending := pkg.GetPendingComments()
 		err := theme.AdminTemplates.ExecuteTemplate(c.Writer, "admin-comments.html", gin.H{
 			"Comments":     comments,
+			"Webmentions":  pkg.GetAllWebmentions(),
 			"PendingCount": len(pending),
 			"Tab":          "comments",
 		})
@@ -765,6 +1165,70 @@ func SetupRouter() *gin.Engine {
 		}
 	})
 
+	// 评论导入导出
+	admin.GET("/comments/transfer", func(c *gin.Context) {
+		err := theme.AdminTemplates.ExecuteTemplate(c.Writer, "admin-comment-transfer.html", gin.H{
+			"Tab": "comments",
+		})
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+	})
+
+	admin.POST("/comments/import", func(c *gin.Context) {
+		file, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请选择要导入的文件"})
+			return
+		}
+		f, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取文件失败"})
+			return
+		}
+
+		report, err := pkg.ImportComments(data, c.PostForm("format"), c.PostForm("dry_run") == "true")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok", "report": report})
+	})
+
+	admin.GET("/comments/export", func(c *gin.Context) {
+		format := c.DefaultQuery("format", pkg.CommentFormatJSON)
+		data, err := pkg.ExportComments(format)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		contentType, ext := "application/xml", "xml"
+		if format == pkg.CommentFormatJSON {
+			contentType, ext = "application/json", "json"
+		}
+		filename := fmt.Sprintf("mdblog-comments-%s-%s.%s", format, time.Now().Format("20060102-150405"), ext)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+		c.Data(http.StatusOK, contentType+"; charset=utf-8", data)
+	})
+
+	// 内容健康检查
+	admin.GET("/content-health", func(c *gin.Context) {
+		report := pkg.CheckContent()
+		err := theme.AdminTemplates.ExecuteTemplate(c.Writer, "admin-health.html", gin.H{
+			"Report": report,
+			"Tab":    "posts",
+		})
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+		}
+	})
+
 	admin.POST("/comments/approve", func(c *gin.Context) {
 		id := c.PostForm("id")
 		pkg.ApproveComment(id)
@@ -777,7 +1241,57 @@ func SetupRouter() *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	admin.POST("/comments/edit", func(c *gin.Context) {
+		id := c.PostForm("id")
+		content := strings.TrimSpace(c.PostForm("content"))
+		if content == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "评论内容不能为空"})
+			return
+		}
+		if err := pkg.UpdateComment(id, content); err != nil {
+			c.JSON(commentEditStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	admin.POST("/comments/spam", func(c *gin.Context) {
+		id := c.PostForm("id")
+		spam := c.PostForm("spam") != "false"
+		if err := pkg.MarkCommentSpam(id, spam); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// 封禁评论者的 IP 或邮箱
+	admin.POST("/comments/ban", func(c *gin.Context) {
+		id := c.PostForm("id")
+		kind := c.PostForm("kind")
+		if err := pkg.BanCommenter(id, kind); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
 	// 基础设置
+	admin.POST("/webmentions/approve", func(c *gin.Context) {
+		pkg.ApproveWebmention(c.PostForm("id"))
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	admin.POST("/webmentions/spam", func(c *gin.Context) {
+		pkg.MarkWebmentionSpam(c.PostForm("id"), c.PostForm("spam") == "true")
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	admin.POST("/webmentions/delete", func(c *gin.Context) {
+		pkg.DeleteWebmention(c.PostForm("id"))
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
 	admin.POST("/settings/update", func(c *gin.Context) {
 		siteTitle := c.PostForm("site_title")
 		siteDesc := c.PostForm("site_desc")
@@ -830,6 +1344,86 @@ func SetupRouter() *gin.Engine {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
+	// 评论审核与反垃圾设置
+	admin.POST("/settings/comments", func(c *gin.Context) {
+		moderation := c.PostForm("moderation")
+		switch moderation {
+		case pkg.ModerationOff, pkg.ModerationFirstTime, pkg.ModerationAll:
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的审核模式"})
+			return
+		}
+		minSubmitTime, _ := strconv.Atoi(c.PostForm("min_submit_time"))
+		rateLimit, _ := strconv.Atoi(c.PostForm("rate_limit"))
+		rateWindow, _ := strconv.Atoi(c.PostForm("rate_window"))
+		maxLinks, _ := strconv.Atoi(c.PostForm("max_links"))
+		editWindow, _ := strconv.Atoi(c.PostForm("edit_window"))
+
+		if err := pkg.UpdateCommentsConfig(moderation, minSubmitTime, rateLimit, rateWindow, maxLinks, editWindow, splitLines(c.PostForm("blocked_keywords"))); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if err := pkg.UpdateCommentBans(splitLines(c.PostForm("banned_ips")), splitLines(c.PostForm("banned_emails"))); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		powDifficulty, _ := strconv.Atoi(c.PostForm("pow_difficulty"))
+		if err := pkg.UpdatePoWConfig(c.PostForm("pow") == "true", powDifficulty); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// 邮件通知设置
+	admin.POST("/settings/mail", func(c *gin.Context) {
+		port, _ := strconv.Atoi(c.PostForm("port"))
+		cfg := pkg.MailConfig{
+			Enabled:       c.PostForm("enabled") == "true",
+			Host:          strings.TrimSpace(c.PostForm("host")),
+			Port:          port,
+			Username:      strings.TrimSpace(c.PostForm("username")),
+			Password:      c.PostForm("password"),
+			From:          strings.TrimSpace(c.PostForm("from")),
+			Security:      c.PostForm("security"),
+			AdminEmail:    strings.TrimSpace(c.PostForm("admin_email")),
+			NotifyReplies: c.PostForm("notify_replies") == "true",
+		}
+		if err := pkg.UpdateMailConfig(cfg); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	admin.POST("/settings/webmention", func(c *gin.Context) {
+		err := pkg.UpdateWebmentionConfig(c.PostForm("enabled") == "true", c.PostForm("send") == "true")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
+	// 发送测试邮件（同步发送，直接返回 SMTP 错误）
+	admin.POST("/settings/mail/test", func(c *gin.Context) {
+		to := pkg.AppConfig.Mail.AdminEmail
+		if to == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请先设置管理员邮箱"})
+			return
+		}
+		err := pkg.SendMail(&pkg.MailMessage{
+			To:      to,
+			Subject: fmt.Sprintf("[%s] 测试邮件", pkg.AppConfig.Site.Title),
+			Body:    "这是一封测试邮件，收到说明 SMTP 配置正确。\n",
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"status": "ok"})
+	})
+
 	// 页脚设置
 	admin.POST("/settings/footer", func(c *gin.Context) {
 		copyright := c.PostForm("copyright")
@@ -918,6 +1512,9 @@ func SetupRouter() *gin.Engine {
 
 		// 返回访问URL
 		url := fmt.Sprintf("/static/uploads/%s", filename)
+
+		// 后台生成缩放版本，不阻塞上传响应
+		go pkg.ProcessUploadedImage(url)
 		c.JSON(http.StatusOK, gin.H{
 			"status": "ok",
 			"url":    url,
@@ -1021,6 +1618,63 @@ func SetupRouter() *gin.Engine {
 	return r
 }
 
+// splitLines 按行拆分文本框内容，去掉空行
+func splitLines(text string) []string {
+	var result []string
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			result = append(result, line)
+		}
+	}
+	return result
+}
+
+// 评论者的编辑令牌保存在 HttpOnly Cookie 中，格式为 评论ID:令牌,评论ID:令牌
+const commentEditCookie = "comment_edit"
+
+// commentEditTokens 读取评论者持有的编辑令牌，评论 ID -> 令牌
+func commentEditTokens(c *gin.Context) map[string]string {
+	tokens := make(map[string]string)
+	value, err := c.Cookie(commentEditCookie)
+	if err != nil {
+		return tokens
+	}
+	for _, pair := range strings.Split(value, ",") {
+		if id, token, ok := strings.Cut(pair, ":"); ok {
+			tokens[id] = token
+		}
+	}
+	return tokens
+}
+
+// rememberCommentEditToken 把新评论的令牌写入 Cookie，顺带丢掉已过期的令牌
+func rememberCommentEditToken(c *gin.Context, id, token string) {
+	window := pkg.CommentEditWindow()
+	if window == 0 {
+		return
+	}
+	tokens := commentEditTokens(c)
+	pairs := []string{id + ":" + token}
+	for editable := range pkg.EditableComments(tokens) {
+		pairs = append(pairs, editable+":"+tokens[editable])
+	}
+	if len(pairs) > 20 {
+		pairs = pairs[:20]
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(commentEditCookie, strings.Join(pairs, ","), int(window.Seconds()), "/", "", c.Request.TLS != nil, true)
+}
+
+func commentEditStatus(err error) int {
+	switch err {
+	case pkg.ErrCommentNotFound:
+		return http.StatusNotFound
+	case pkg.ErrCommentEditDenied, pkg.ErrCommentEditExpired:
+		return http.StatusForbidden
+	}
+	return http.StatusInternalServerError
+}
+
 // 添加目录到 zip
 func addDirToZip(zipWriter *zip.Writer, srcDir, baseInZip string) error {
 	return filepath.Walk(srcDir, func(path string, info os.FileInfo, err error) error {
@@ -1132,9 +1786,140 @@ type RSSItem struct {
 	GUID        string `xml:"guid"`
 }
 
+// Atom Feed 结构
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	NS      string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    string      `xml:"author>name"`
+	Link      AtomLink    `xml:"link"`
+	Content   AtomContent `xml:"content"`
+}
+
+type AtomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// generateCommentFeed 生成最新评论的 RSS 或 Atom，post 为 nil 时为全站评论
+func generateCommentFeed(post *pkg.Post, atom bool) string {
+	baseURL := strings.TrimSuffix(pkg.AppConfig.Site.BaseURL, "/")
+	title := pkg.AppConfig.Site.Title + " 的评论"
+	link := baseURL + "/"
+	postID := ""
+	self := "/comments/feed.xml"
+	if atom {
+		self = "/comments/atom.xml"
+	}
+	self = baseURL + self
+	if post != nil {
+		title = "《" + post.Title + "》的评论"
+		link = baseURL + post.Permalink() + "#comments"
+		postID = post.ID
+		self += "?post=" + url.QueryEscape(post.ID)
+	}
+
+	comments := pkg.GetRecentComments(postID, 20)
+	type feedItem struct {
+		comment pkg.Comment
+		title   string
+		link    string
+	}
+	items := make([]feedItem, 0, len(comments))
+	for _, comment := range comments {
+		p := post
+		if p == nil {
+			if p = pkg.GetPostByID(comment.PostID); p == nil {
+				continue
+			}
+		}
+		items = append(items, feedItem{
+			comment: comment,
+			title:   comment.Author + " 评论了《" + p.Title + "》",
+			link:    baseURL + p.Permalink() + "#comment-" + comment.ID,
+		})
+	}
+
+	if !atom {
+		rss := RSS{
+			Version: "2.0",
+			Channel: RSSChannel{
+				Title:       title,
+				Link:        link,
+				Description: title,
+				Items:       make([]RSSItem, 0, len(items)),
+			},
+		}
+		for _, item := range items {
+			rss.Channel.Items = append(rss.Channel.Items, RSSItem{
+				Title:       item.title,
+				Link:        item.link,
+				Description: item.comment.ContentHTML,
+				PubDate:     item.comment.CreatedAt.Format(time.RFC1123Z),
+				GUID:        item.link,
+			})
+		}
+		output, _ := xml.MarshalIndent(rss, "", "  ")
+		return xml.Header + string(output)
+	}
+
+	feed := AtomFeed{
+		NS:    "http://www.w3.org/2005/Atom",
+		ID:    self,
+		Title: title,
+		Links: []AtomLink{
+			{Href: self, Rel: "self", Type: "application/atom+xml"},
+			{Href: link, Rel: "alternate", Type: "text/html"},
+		},
+	}
+	var updated time.Time
+	for _, item := range items {
+		modified := item.comment.CreatedAt
+		if edited := item.comment.EditedTime(); edited.After(modified) {
+			modified = edited
+		}
+		if modified.After(updated) {
+			updated = modified
+		}
+		feed.Entries = append(feed.Entries, AtomEntry{
+			ID:        item.link,
+			Title:     item.title,
+			Published: item.comment.CreatedAt.Format(time.RFC3339),
+			Updated:   modified.Format(time.RFC3339),
+			Author:    item.comment.Author,
+			Link:      AtomLink{Href: item.link, Rel: "alternate"},
+			Content:   AtomContent{Type: "html", Body: item.comment.ContentHTML},
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+
+	output, _ := xml.MarshalIndent(feed, "", "  ")
+	return xml.Header + string(output)
+}
+
 func generateRSSFeed() string {
 	items := make([]RSSItem, 0, 20)
-	posts := pkg.Posts
+	posts := pkg.PublishedPosts()
 	if len(posts) > 20 {
 		posts = posts[:20]
 	}
@@ -1185,17 +1970,17 @@ func generateSitemap() string {
 	}
 
 	// 添加所有文章
-	for _, post := range pkg.Posts {
+	for _, post := range pkg.PublishedPosts() {
 		urls = append(urls, SitemapURL{
 			Loc:        fmt.Sprintf("%s/%s/%s.html", pkg.AppConfig.Site.BaseURL, post.Category, post.Slug),
-			LastMod:    post.Date.Format("2006-01-02"),
+			LastMod:    post.LastModified().Format("2006-01-02"),
 			ChangeFreq: "weekly",
 			Priority:   "0.8",
 		})
 	}
 
 	// 添加分类页
-	cats, _ := pkg.ListCategories()
+	cats := pkg.CachedCategories()
 	for _, cat := range cats {
 		urls = append(urls, SitemapURL{
 			Loc:        fmt.Sprintf("%s/category/%s", pkg.AppConfig.Site.BaseURL, cat.Name),
@@ -1305,6 +2090,27 @@ func getCategories(c *gin.Context) {
 	c.JSON(http.StatusOK, Response{Code: 0, Message: "success", Data: categories})
 }
 
+// getStats 获取访问统计
+// @Summary 获取访问统计
+// @Description 按时间段汇总访问量、独立访客、文章、来源和 UTM 数据，需 Bearer 令牌（stats.api_token）
+// @Tags 统计
+// @Produce json
+// @Security BearerAuth
+// @Param from query string false "开始日期 YYYY-MM-DD，默认 30 天前"
+// @Param to query string false "结束日期 YYYY-MM-DD，默认今天"
+// @Success 200 {object} Response{data=pkg.StatsReport}
+// @Failure 400 {object} Response
+// @Failure 401 {object} Response
+// @Router /api/stats [get]
+func getStats(c *gin.Context) {
+	from, to, err := pkg.ParseStatsRange(c.Query("from"), c.Query("to"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{Code: 400, Message: err.Error(), Data: nil})
+		return
+	}
+	c.JSON(http.StatusOK, Response{Code: 0, Message: "success", Data: pkg.GetStatsReport(from, to)})
+}
+
 // getInfo 获取站点信息
 // @Summary 获取站点信息
 // @Description 获取博客站点基本信息
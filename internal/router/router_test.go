@@ -0,0 +1,186 @@
+package router
+
+import (
+	"fmt"
+	"mdblog/internal/pkg"
+	"mdblog/internal/theme"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setupTestSite 在临时目录中搭建站点：使用仓库的示例配置、主题（复制一份，测试会修改）和后台模板
+func setupTestSite(t *testing.T) *gin.Engine {
+	t.Helper()
+	root, err := filepath.Abs(filepath.Join("..", ".."))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(t.TempDir())
+	if err := os.CopyFS("themes", os.DirFS(filepath.Join(root, "themes"))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "admin"), "admin"); err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(filepath.Join(root, "config.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile("config.yaml", config, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("LOG_LEVEL", "error")
+	gin.SetMode(gin.TestMode)
+	pkg.InitConfig()
+	pkg.AppConfig.Search.IndexPath = filepath.Join(t.TempDir(), "index")
+	pkg.AppConfig.Cache.Pages = true
+
+	writePosts(t, 0)
+	pkg.InitMarkdown()
+	pkg.InitStore()
+	pkg.InitComments()
+	pkg.InitStats()
+	theme.InitPongo2()
+	theme.LoadAdminTemplates()
+	return SetupRouter()
+}
+
+func writePosts(t *testing.T, rev int) {
+	t.Helper()
+	posts := map[string]string{
+		"tech/go.md":   fmt.Sprintf("id: 01GO\ntitle: Go 并发 %d\ndate: 2026-01-02\ntags: [go]", rev),
+		"tech/rust.md": "id: 01RUST\ntitle: Rust\ndate: 2026-01-01\ntags: [rust]",
+		"life/day.md":  "id: 01DAY\ntitle: 日常\ndate: 2026-01-03\ntags: [go]",
+	}
+	for name, frontMatter := range posts {
+		path := filepath.Join("content", "blog", filepath.FromSlash(name))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		body := "---\n" + frontMatter + "\n---\n\n正文 goroutine\n"
+		if err := os.WriteFile(path, []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// TestConcurrentReloadAndRequests 后台重新载入文章的同时并发请求前台页面，用 -race 运行
+func TestConcurrentReloadAndRequests(t *testing.T) {
+	r := setupTestSite(t)
+	paths := []string{"/tech/go.html", "/life/day.html", "/", "/tag/go", "/category/tech", "/feed.xml", "/sitemap.xml", "/health/ready"}
+
+	var done atomic.Bool
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := i; !done.Load(); n++ {
+				path := paths[n%len(paths)]
+				w := get(r, path)
+				if w.Code != http.StatusOK {
+					errs <- fmt.Errorf("GET %s: %d %s", path, w.Code, w.Body.String())
+					return
+				}
+			}
+		}(i)
+	}
+
+	for rev := 1; rev <= 15; rev++ {
+		writePosts(t, rev)
+		pkg.LoadAllPosts()
+		pkg.InitSearchIndex()
+	}
+	done.Store(true)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	w := get(r, "/tech/go.html")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Go 并发 15") {
+		t.Errorf("latest reload not served: %d", w.Code)
+	}
+}
+
+// TestThemeEditInvalidatesCache 修改主题模板后不需要重启，缓存的页面也随之失效
+func TestThemeEditInvalidatesCache(t *testing.T) {
+	r := setupTestSite(t)
+	get(r, "/")
+	if w := get(r, "/"); w.Header().Get("X-Cache") != "HIT" {
+		t.Fatalf("second request X-Cache = %q, want HIT", w.Header().Get("X-Cache"))
+	}
+
+	layout := filepath.Join("themes", "pure", "layouts", "base.html")
+	data, err := os.ReadFile(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = []byte(strings.Replace(string(data), "</body>", "<!-- theme-edit-marker --></body>", 1))
+	if err := os.WriteFile(layout, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 后台每秒检查一次模板目录，在此之前继续返回缓存的旧页面
+	var w *httptest.ResponseRecorder
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(100 * time.Millisecond) {
+		if w = get(r, "/"); strings.Contains(w.Body.String(), "theme-edit-marker") {
+			break
+		}
+	}
+	if !strings.Contains(w.Body.String(), "theme-edit-marker") {
+		t.Fatal("edited template not used")
+	}
+	if w.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("X-Cache = %q after theme edit, want MISS", w.Header().Get("X-Cache"))
+	}
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+// TestHealthReadyHidesDetails 公开的就绪检查不输出文件路径和具体错误
+func TestHealthReadyHidesDetails(t *testing.T) {
+	r := setupTestSite(t)
+	if w := get(r, "/health/ready"); w.Code != http.StatusOK {
+		t.Fatalf("GET /health/ready: %d %s", w.Code, w.Body.String())
+	}
+
+	broken := filepath.Join("content", "blog", "tech", "broken.md")
+	if err := os.WriteFile(broken, []byte("---\ntitle: [unclosed\n---\n\nbody\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	pkg.LoadAllPosts()
+	layout := filepath.Join("themes", "pure", "layouts", "base.html")
+	if err := os.WriteFile(layout, []byte("{% if %}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	theme.InitPongo2()
+
+	w := get(r, "/health/ready")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d with a broken template, want 503", w.Code)
+	}
+	body := w.Body.String()
+	if !strings.Contains(body, `"templates":{"status":"fail"`) {
+		t.Errorf("template failure not reported: %s", body)
+	}
+	for _, leak := range []string{"broken.md", "base.html", "content/", "themes/"} {
+		if strings.Contains(body, leak) {
+			t.Errorf("readiness response contains %q: %s", leak, body)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package theme
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 静态资源指纹：模板中用 {{ asset("style.css") }} 输出 /static/style.<hash>.css，
+// 文件内容变化后地址随之变化，因此带指纹的地址可以长期缓存
+
+type assetInfo struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+var (
+	assetLock   sync.Mutex
+	assetHashes = make(map[string]assetInfo)
+
+	fingerprintPattern = regexp.MustCompile(`^(.+)\.([0-9a-f]{10})(\.[A-Za-z0-9]+)$`)
+)
+
+// StaticDir 当前主题的静态资源目录
+func StaticDir() string {
+	return filepath.Join("themes", themeName(), "static")
+}
+
+// assetHash 返回静态资源内容哈希的前 10 位，文件不存在时返回空。按修改时间和大小缓存
+func assetHash(name string) string {
+	file := filepath.Join(StaticDir(), filepath.FromSlash(path.Clean("/"+name)))
+	info, err := os.Stat(file)
+	if err != nil || !info.Mode().IsRegular() {
+		return ""
+	}
+
+	assetLock.Lock()
+	defer assetLock.Unlock()
+	if a, ok := assetHashes[file]; ok && a.modTime.Equal(info.ModTime()) && a.size == info.Size() {
+		return a.hash
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])[:10]
+	assetHashes[file] = assetInfo{modTime: info.ModTime(), size: info.Size(), hash: hash}
+	return hash
+}
+
+// AssetURL 带内容指纹的静态资源地址，如 style.css -> /static/style.1a2b3c4d5e.css，文件不存在时返回普通地址
+func AssetURL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	hash := assetHash(name)
+	if hash == "" {
+		return "/static/" + name
+	}
+	ext := path.Ext(name)
+	return "/static/" + strings.TrimSuffix(name, ext) + "." + hash + ext
+}
+
+// ServeStatic 提供主题静态资源。带指纹且与当前内容一致的地址可永久缓存；
+// 指纹已过期时仍返回当前文件，但不允许缓存
+func ServeStatic(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+	if m := fingerprintPattern.FindStringSubmatch(name); m != nil {
+		if hash := assetHash(m[1] + m[3]); hash != "" {
+			name = m[1] + m[3]
+			if hash == m[2] {
+				c.Header("Cache-Control", "public, max-age=31536000, immutable")
+			} else {
+				c.Header("Cache-Control", "no-cache")
+			}
+		}
+	}
+
+	file := filepath.Join(StaticDir(), filepath.FromSlash(path.Clean("/"+name)))
+	if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.File(file)
+}
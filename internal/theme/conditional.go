@@ -0,0 +1,71 @@
+package theme
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"mdblog/internal/pkg"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ETag 由内容计算弱 ETag（响应可能被 gzip 压缩，不保证字节一致）
+func ETag(parts ...[]byte) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write(p)
+	}
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:12]) + `"`
+}
+
+// ServeConditional 输出带 ETag、Last-Modified 的响应，客户端缓存仍有效时返回 304。
+// Cache-Control: no-cache 让浏览器每次都带验证器回来确认，而不是按启发式规则直接使用旧页面
+func ServeConditional(c *gin.Context, contentType, etag string, modTime time.Time, body []byte) {
+	c.Header("Cache-Control", "no-cache")
+	c.Header("ETag", etag)
+	if !modTime.IsZero() {
+		c.Header("Last-Modified", modTime.UTC().Format(http.TimeFormat))
+	}
+	if notModified(c.Request, etag, modTime) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, contentType, body)
+}
+
+// notModified 按 RFC 9110：有 If-None-Match 时只看它，否则比较 If-Modified-Since
+func notModified(r *http.Request, etag string, modTime time.Time) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if modTime.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	return err == nil && !modTime.Truncate(time.Second).After(since)
+}
+
+// writePage 输出渲染好的页面（令牌尚未填入）。带评论表单的页面里的令牌 24 小时内有效，
+// 这类页面的验证器按天变化，客户端不会在第二天还通过 304 沿用旧令牌
+func writePage(c *gin.Context, body []byte) {
+	modTime := pkg.SiteLastModified()
+	etag := ETag(body)
+	if bytes.Contains(body, []byte(pkg.CommentTokenPlaceholder)) {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		if today.After(modTime) {
+			modTime = today
+		}
+		etag = ETag(body, []byte(today.Format("2006-01-02")))
+	}
+	ServeConditional(c, "text/html; charset=utf-8", etag, modTime, pkg.FillPageTokens(body))
+}
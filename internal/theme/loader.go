@@ -1,30 +1,149 @@
 package theme
 
 import (
+	"fmt"
 	"html/template"
+	"io/fs"
+	"log/slog"
 	"mdblog/internal/pkg"
 	"net/http"
+	"net/url"
+	"os"
 	"path/filepath"
-	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/flosch/pongo2/v6"
 	"github.com/gin-gonic/gin"
 )
 
 var (
-	ThemeSet       *pongo2.TemplateSet
-	AdminTemplates *template.Template // 保持后台使用原生模板
+	themeSet       atomic.Pointer[pongo2.TemplateSet] // 前台模板，切换主题或模板文件变化时整体替换
+	AdminTemplates *template.Template                 // 保持后台使用原生模板
+
+	themeLock      sync.Mutex // 串行化主题的载入和后台检查
+	loadedTheme    string     // 当前载入的主题名，后台检查只读这里，不读配置
+	themeStamp     string     // 模板目录的文件数和最近修改时间，变化即说明模板被修改
+	themeWatchOnce sync.Once
+
+	templateCheck atomic.Pointer[templateCheckResult] // 最近一次载入主题时的模板编译结果
 )
 
+type templateCheckResult struct {
+	err error
+}
+
+// themeCheckInterval 后台检查模板文件是否变化的间隔
+const themeCheckInterval = time.Second
+
+// InitPongo2 加载前台主题，并启动后台检查：模板文件变化后自动重新加载，请求路径上不访问磁盘
 func InitPongo2() {
-	themeName := pkg.AppConfig.Theme
-	if themeName == "" {
-		themeName = "pure"
+	themeLock.Lock()
+	loadTheme(themeName())
+	themeLock.Unlock()
+
+	themeWatchOnce.Do(func() {
+		go func() {
+			for range time.Tick(themeCheckInterval) {
+				reloadThemeIfChanged()
+			}
+		}()
+	})
+}
+
+// loadTheme 载入主题的模板集并检查模板，调用方需持有 themeLock
+func loadTheme(name string) {
+	loadedTheme = name
+	themeStamp = themeDirStamp(name)
+	themeSet.Store(newThemeSet(name))
+	checkThemeTemplates(name)
+}
+
+// reloadThemeIfChanged 模板目录有文件被修改、新增或删除时换用新的模板集，并清空整页缓存
+func reloadThemeIfChanged() {
+	themeLock.Lock()
+	defer themeLock.Unlock()
+	stamp := themeDirStamp(loadedTheme)
+	// 模板目录暂时不存在（如正在整体替换主题）时沿用已载入的模板
+	if loadedTheme == "" || stamp == "" || stamp == themeStamp {
+		return
 	}
-	
+	loadTheme(loadedTheme)
+	pkg.InvalidatePageCache()
+	slog.Info("theme templates changed, reloaded", "theme", loadedTheme)
+}
+
+// themeDirStamp 主题模板目录的文件数和最近修改时间，目录不存在时返回空。
+// 静态资源不影响页面缓存，不在检查范围内
+func themeDirStamp(name string) string {
+	dir := filepath.Join("themes", name, "layouts")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return ""
+	}
+	var latest time.Time
+	files := 0
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		files++
+		return nil
+	})
+	return fmt.Sprintf("%s:%d:%d", name, files, latest.UnixNano())
+}
+
+func newThemeSet(name string) *pongo2.TemplateSet {
 	// 设置 Pongo2 模板加载路径 (前台)
-	loader := pongo2.MustNewLocalFileSystemLoader(filepath.Join("themes", themeName, "layouts"))
-	ThemeSet = pongo2.NewSet(themeName, loader)
+	loader := pongo2.MustNewLocalFileSystemLoader(filepath.Join("themes", name, "layouts"))
+	return pongo2.NewSet(name, loader)
+}
+
+// CheckTemplates 返回最近一次载入主题时的模板编译结果，供健康检查使用
+func CheckTemplates() error {
+	result := templateCheck.Load()
+	if themeSet.Load() == nil || AdminTemplates == nil || result == nil {
+		return fmt.Errorf("模板尚未加载")
+	}
+	return result.err
+}
+
+// checkThemeTemplates 编译主题的全部模板并缓存结果，载入或重新载入主题时调用
+func checkThemeTemplates(name string) {
+	err := compileTemplates(name)
+	if err != nil {
+		slog.Error("theme templates failed to compile", "theme", name, "err", err)
+	}
+	templateCheck.Store(&templateCheckResult{err: err})
+}
+
+// compileTemplates 编译主题的全部模板，返回第一个出错的模板
+func compileTemplates(name string) error {
+	files, err := filepath.Glob(filepath.Join("themes", name, "layouts", "*.html"))
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("主题 %s 没有模板", name)
+	}
+	// 用单独的模板集按磁盘上的当前内容编译，不影响正在使用的缓存
+	set := newThemeSet(name)
+	for _, file := range files {
+		if _, err := set.FromFile(filepath.Base(file)); err != nil {
+			return fmt.Errorf("%s: %w", filepath.Base(file), err)
+		}
+	}
+	return nil
+}
+
+func themeName() string {
+	if pkg.AppConfig.Theme == "" {
+		return "pure"
+	}
+	return pkg.AppConfig.Theme
 }
 
 // LoadAdminTemplates 仅加载后台模板
@@ -42,30 +161,86 @@ func LoadAdminTemplates() {
 
 // Render Pongo2 统一渲染函数 (用于前台)
 func Render(c *gin.Context, templateName string, data gin.H) {
-	tmpl, err := ThemeSet.FromFile(templateName)
+	tmpl, err := themeSet.Load().FromCache(templateName)
 	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "template error", "template", templateName, "err", err)
 		c.String(http.StatusInternalServerError, "Template Error: "+err.Error())
 		return
 	}
 
-	cats, _ := pkg.ListCategories()
-	sort.Slice(cats, func(i, j int) bool {
-		return cats[i].Name < cats[j].Name
-	})
-
-	pages, _ := pkg.ListVisiblePages()
-
 	ctx := pongo2.Context{
 		"Site":          pkg.AppConfig.Site,
-		"NavCategories": cats,
-		"NavPages":      pages,
+		"NavCategories": pkg.CachedCategories(),
+		"NavPages":      pkg.CachedVisiblePages(),
+		"asset":         AssetURL,
 	}
 	for k, v := range data {
 		ctx[k] = v
 	}
 
-	err = tmpl.ExecuteWriter(ctx, c.Writer)
+	start := time.Now()
+	body, err := tmpl.ExecuteBytes(ctx)
+	pkg.ObserveTemplateRender(templateName, time.Since(start))
 	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "render error", "template", templateName, "err", err)
 		c.String(http.StatusInternalServerError, "Render Error: "+err.Error())
+		return
+	}
+
+	if v, ok := c.Get(pageCacheContextKey); ok {
+		entry := v.(pageCacheEntry)
+		pkg.StoreCachedPage(entry.key, entry.gen, body)
+	}
+	writePage(c, body)
+}
+
+const pageCacheContextKey = "theme.pageCache"
+
+type pageCacheEntry struct {
+	key string
+	gen uint64
+}
+
+// ServeCachedPage 对当前请求启用整页缓存：命中时直接输出缓存并返回 true；
+// 未命中时返回 false，之后 Render 的结果会写入缓存。
+// 已登录的管理员和持有评论编辑令牌的访客看到的页面不同，不使用缓存
+func ServeCachedPage(c *gin.Context) bool {
+	if !pkg.PageCacheEnabled() || c.Request.Method != http.MethodGet {
+		return false
+	}
+	for _, name := range []string{"admin_session", "comment_edit"} {
+		if _, err := c.Cookie(name); err == nil {
+			return false
+		}
+	}
+
+	key := pageCacheKey(c)
+	if body, ok := pkg.GetCachedPage(key); ok {
+		c.Header("X-Cache", "HIT")
+		writePage(c, body)
+		return true
+	}
+	c.Header("X-Cache", "MISS")
+	c.Set(pageCacheContextKey, pageCacheEntry{key: key, gen: pkg.PageCacheGeneration()})
+	return false
+}
+
+// pageCacheParams 影响前台页面内容的查询参数，其余参数（utm_* 等）不参与区分页面，
+// 避免随意构造的参数把缓存挤满
+var pageCacheParams = []string{"page", "cpage", "comment_sort"}
+
+// pageCacheKey 主题 + 路径 + 排序后的有效查询参数
+func pageCacheKey(c *gin.Context) string {
+	all := c.Request.URL.Query()
+	query := url.Values{}
+	for _, name := range pageCacheParams {
+		if v := all.Get(name); v != "" {
+			query.Set(name, v)
+		}
+	}
+	key := themeName() + "\x00" + c.Request.URL.Path
+	if len(query) > 0 {
+		key += "?" + query.Encode()
 	}
+	return key
 }
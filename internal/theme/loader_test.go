@@ -0,0 +1,64 @@
+package theme
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPageCacheKeyIgnoresUnknownParams(t *testing.T) {
+	key := func(target string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", target, nil)
+		return pageCacheKey(c)
+	}
+
+	base := key("/tech/post.html")
+	for _, target := range []string{"/tech/post.html?x=1", "/tech/post.html?utm_source=feed", "/tech/post.html?x=2&fbclid=abc"} {
+		if got := key(target); got != base {
+			t.Errorf("%s: key %q, want %q", target, got, base)
+		}
+	}
+
+	if key("/?page=2") == key("/") {
+		t.Error("page parameter ignored")
+	}
+	if key("/tech/post.html?comment_sort=newest&cpage=2") != key("/tech/post.html?cpage=2&x=1&comment_sort=newest") {
+		t.Error("key depends on parameter order or unknown parameters")
+	}
+}
+
+func TestThemeDirStampOnlyWatchesLayouts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if got := themeDirStamp("pure"); got != "" {
+		t.Errorf("missing theme stamp = %q, want empty", got)
+	}
+
+	layouts := filepath.Join("themes", "pure", "layouts")
+	static := filepath.Join("themes", "pure", "static")
+	os.MkdirAll(layouts, 0755)
+	os.MkdirAll(static, 0755)
+	os.WriteFile(filepath.Join(layouts, "base.html"), []byte("a"), 0644)
+	stamp := themeDirStamp("pure")
+
+	later := time.Now().Add(time.Minute)
+	os.WriteFile(filepath.Join(static, "style.css"), []byte("b"), 0644)
+	os.Chtimes(filepath.Join(static, "style.css"), later, later)
+	if got := themeDirStamp("pure"); got != stamp {
+		t.Errorf("static file changed the stamp: %q -> %q", stamp, got)
+	}
+
+	os.Chtimes(filepath.Join(layouts, "base.html"), later, later)
+	if got := themeDirStamp("pure"); got == stamp {
+		t.Error("layout edit did not change the stamp")
+	}
+	os.WriteFile(filepath.Join(layouts, "post.html"), []byte("c"), 0644)
+	os.Chtimes(filepath.Join(layouts, "post.html"), later, later)
+	if got := themeDirStamp("pure"); got == stamp {
+		t.Error("new layout did not change the stamp")
+	}
+}
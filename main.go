@@ -3,19 +3,26 @@
 // @description 轻量级 Markdown 博客系统 API
 // @host localhost:8080
 // @BasePath /
+// @securityDefinitions.apikey BearerAuth
+// @in header
+// @name Authorization
+// @description 格式：Bearer <stats.api_token>
 
 package main
 
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
+	"log/slog"
 	"mdblog/internal/pkg"
 	"mdblog/internal/router"
 	"mdblog/internal/theme"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -31,6 +38,21 @@ func main() {
 	// 1. Initialize Config
 	pkg.InitConfig()
 
+	// 子命令：mdblog check [-strict]
+	if flag.Arg(0) == "check" {
+		os.Exit(runCheck(flag.Args()[1:]))
+	}
+
+	// 子命令：mdblog comments import|export ...
+	if flag.Arg(0) == "comments" {
+		os.Exit(runComments(flag.Args()[1:]))
+	}
+
+	// 子命令：mdblog ids
+	if flag.Arg(0) == "ids" {
+		os.Exit(runIDs())
+	}
+
 	// 2. Set Gin Mode (release for production)
 	if os.Getenv("GIN_MODE") == "" {
 		gin.SetMode(gin.ReleaseMode)
@@ -54,9 +76,28 @@ func main() {
 	// 5. Initialize Comments
 	pkg.InitComments()
 
+	// 评论邮件通知队列
+	pkg.InitMail()
+
+	// Webmention 收发队列
+	pkg.InitWebmention()
+
 	// 6. Initialize Stats
 	pkg.InitStats()
 
+	// 旧版按 slug 记录的评论和统计迁移为按文章 ID 记录
+	pkg.MigratePostIdentity()
+
+	// 为还没有 id 的文章写入 ULID，评论和统计不再挂在可变的 category/slug 上
+	n, err := pkg.AssignPostIDs()
+	if err != nil {
+		slog.Error("failed to assign post ids", "err", err)
+	}
+	if n > 0 {
+		slog.Info("assigned post ids", "count", n)
+		pkg.InitSearchIndex()
+	}
+
 	// 5. Load Theme Templates
 	theme.InitPongo2()         // 前台 Pongo2
 	theme.LoadAdminTemplates() // 后台 原生模板
@@ -72,24 +113,167 @@ func main() {
 
 	// 8. Start Server in goroutine
 	go func() {
-		log.Printf("Server starting on port %s...", pkg.AppConfig.Port)
+		slog.Info("server starting", "port", pkg.AppConfig.Port)
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Failed to start server: %v", err)
+			slog.Error("failed to start server", "err", err)
+			os.Exit(1)
 		}
 	}()
 
+	// Prometheus 指标的单独监听地址
+	var metricsSrv *http.Server
+	if m := pkg.AppConfig.Metrics; m.Enabled && m.Listen != "" {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/metrics", router.MetricsHandler)
+		metricsSrv = &http.Server{Addr: m.Listen, Handler: mux}
+		go func() {
+			slog.Info("metrics listening", "addr", m.Listen)
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				slog.Error("failed to start metrics server", "err", err)
+			}
+		}()
+	} else if m.Enabled && m.Token == "" {
+		slog.Warn("metrics.enabled is set but neither metrics.token nor metrics.listen is configured, /metrics is not exposed")
+	}
+
 	// 9. Graceful Shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatal("Server forced to shutdown:", err)
+		slog.Error("server forced to shutdown", "err", err)
 	}
+	if metricsSrv != nil {
+		metricsSrv.Shutdown(ctx)
+	}
+
+	// 写入内存中尚未保存的访问统计
+	if err := pkg.FlushStats(); err != nil {
+		slog.Error("failed to save stats", "err", err)
+	}
+
+	slog.Info("server exited gracefully")
+}
+
+// runCheck 检查内容并输出报告，存在错误（-strict 时包括警告）返回非零退出码
+func runCheck(args []string) int {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	strict := fs.Bool("strict", false, "警告也视为失败")
+	fs.Parse(args)
+
+	pkg.InitMarkdown()
+	report := pkg.CheckContent()
+
+	for _, issue := range report.Issues {
+		fmt.Printf("%-7s %s: %s\n", strings.ToUpper(issue.Level), issue.FilePath, issue.Message)
+	}
+	fmt.Printf("\n检查了 %d 个文件：%d 个错误，%d 个警告\n", report.Files, report.ErrorCount(), report.WarningCount())
+
+	if report.HasErrors() || (*strict && report.WarningCount() > 0) {
+		return 1
+	}
+	return 0
+}
 
-	log.Println("Server exited gracefully")
+// runIDs 为没有 front matter id 的文章写入 ID，并迁移按旧 ID 记录的评论、统计和 Webmention。
+// 会修改文章文件和 data 目录，请先停止服务
+func runIDs() int {
+	pkg.InitMarkdown()
+	pkg.LoadAllPosts()
+	pkg.InitComments()
+	pkg.InitWebmention()
+	pkg.InitStats()
+	pkg.MigratePostIdentity()
+
+	n, err := pkg.AssignPostIDs()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Printf("已为 %d 篇文章写入 id\n", n)
+	return 0
+}
+
+// runComments 评论导入导出。服务运行中导入会被其内存数据覆盖，请先停止服务或使用后台页面
+//
+//	mdblog comments import [-format disqus|wxr|json] [-dry-run] <file>
+//	mdblog comments export -format disqus|wxr|json [-o file]
+func runComments(args []string) int {
+	usage := "用法:\n  mdblog comments import [-format disqus|wxr|json] [-dry-run] <file>\n  mdblog comments export -format disqus|wxr|json [-o file]"
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return 2
+	}
+
+	pkg.InitMarkdown()
+	pkg.LoadAllPosts()
+	pkg.InitComments()
+
+	switch args[0] {
+	case "import":
+		fs := flag.NewFlagSet("comments import", flag.ExitOnError)
+		format := fs.String("format", "", "文件格式，默认按内容识别")
+		dryRun := fs.Bool("dry-run", false, "只检查不写入")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			fmt.Println(usage)
+			return 2
+		}
+		data, err := os.ReadFile(fs.Arg(0))
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		report, err := pkg.ImportComments(data, *format, *dryRun)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		printImportReport(report)
+		return 0
+
+	case "export":
+		fs := flag.NewFlagSet("comments export", flag.ExitOnError)
+		format := fs.String("format", "json", "导出格式")
+		output := fs.String("o", "", "输出文件，默认输出到标准输出")
+		fs.Parse(args[1:])
+		data, err := pkg.ExportComments(*format)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if *output == "" {
+			os.Stdout.Write(data)
+			return 0
+		}
+		if err := os.WriteFile(*output, data, 0644); err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Printf("已导出到 %s\n", *output)
+		return 0
+	}
+
+	fmt.Println(usage)
+	return 2
+}
+
+func printImportReport(r *pkg.CommentImportReport) {
+	for _, t := range r.Unmatched {
+		fmt.Printf("未匹配  %s (%s)：%d 条评论\n", t.Title, t.URL, t.Comments)
+	}
+	action := "已导入"
+	if r.DryRun {
+		action = "可导入"
+	}
+	fmt.Printf("\n格式 %s：%d 个讨论串，%d 条评论；%s %d 条，重复 %d 条，忽略 %d 条，%d 个讨论串未匹配\n",
+		r.Format, r.Threads, r.Total, action, r.Imported, r.Duplicate, r.Skipped, len(r.Unmatched))
+	if r.DryRun {
+		fmt.Println("（试运行，未写入数据）")
+	}
 }